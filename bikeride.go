@@ -27,20 +27,35 @@ func main() {
 	if emptyCommandLine(os.Args, l) {
 		return
 	}
-	p, e := param.New(os.Args, l)
-	if e != nil {
-		l.Err(e)
+	if os.Args[1] == "compare" {
+		compare(os.Args, l)
 		return
 	}
-	if e := checkResultDir(p, l); e != nil {
-		l.Err(e)
+	if os.Args[1] == "fit" {
+		fitPower(os.Args, l)
 		return
 	}
-	if e := initLogger(p, l); e != nil {
-		l.Err(e)
+	if os.Args[1] == "calibrate" {
+		calibrate(os.Args, l)
 		return
 	}
-	if e := p.Check(l); e != nil {
+	if os.Args[1] == "power-table" {
+		powerTableCmd(os.Args, l)
+		return
+	}
+	p, rou, res, ok := runRide(os.Args, l)
+	if !ok {
+		return
+	}
+	writeAllResults(p, l, res, rou)
+}
+
+// runRide reads the parameters and the route by the command line args,
+// calculates the ride and returns the results. Errors are logged and ok
+// is false on error.
+func runRide(args []string, l *logerr.Logerr) (p *param.Parameters, rou *route.Route, res *route.Results, ok bool) {
+	p, e := readParameters(args, l)
+	if e != nil {
 		return
 	}
 	gpxfile := p.GPXdir + p.GPXfile
@@ -49,13 +64,40 @@ func main() {
 		l.Err(e)
 		return
 	}
+	for _, f := range p.AppendGPX {
+		g, e := gpx.New(p.GPXdir+f, p.GPXuseXMLparser, p.GPXignoreErrors)
+		if e != nil {
+			l.Err(e)
+			return
+		}
+		gpz.Append(g)
+	}
 	p.UnitConversionIn()
 
-	rou, e := route.New(gpz, p)
+	rou, e = route.New(gpz, p)
 	if e != nil {
 		l.Err(e)
 		return
 	}
+	fc, e := readForecast(p)
+	if e != nil {
+		l.Err("Wind forecast:", e)
+		return
+	}
+	if fc != nil {
+		rou.SetWindForecast(fc)
+		if p.Environment.SegmentRho {
+			rou.SetTemperatureForecast(fc)
+		}
+	}
+	wf, e := readWindField(p)
+	if e != nil {
+		l.Err("Wind field:", e)
+		return
+	}
+	if wf != nil {
+		rou.SetWindField(wf)
+	}
 	cal := motion.Calculator()
 	gen := power.RatioGenerator()
 
@@ -66,21 +108,42 @@ func main() {
 	rou.SetupRoad(p)
 	rou.Filter()
 
-	if e := rou.SetupRide(cal, gen, p); e != nil {
+	if e := rou.RideIterated(cal, gen, p); e != nil {
 		l.Err(sysErrorMsg(e, cal, l))
 		return
 	}
-	rou.Ride(cal, p)
-	rou.UphillBreaks(p)
-	res := rou.Results(cal, p, l)
+	if !rou.Converged() {
+		l.Msg(0, "Ride time did not converge in the calculation rounds")
+	}
+	if fc != nil && !fc.Covers(rou.Time) {
+		l.Msg(0, "Wind forecast does not cover the whole ride")
+	}
+	res = rou.Results(cal, p, l)
 	if test && p.LogMode >= 0 {
 		rou.Log(p, l)
 	}
-	if test && len(os.Args) > 2 && os.Args[2] == "-prof" {
+	if test && len(args) > 2 && args[2] == "-prof" {
 		res = cpuProfile(gpz, cal, gen, p, l)
 	}
 	p.UnitConversionOut()
-	writeAllResults(p, l, res, rou)
+	return p, rou, res, true
+}
+
+// readParameters reads and checks the parameters by the command line args
+// and sets up the result directory and the logger. Errors are logged.
+func readParameters(args []string, l *logerr.Logerr) (*param.Parameters, error) {
+	p, e := param.New(args, l)
+	if e == nil {
+		e = checkResultDir(p, l)
+	}
+	if e == nil {
+		e = initLogger(p, l)
+	}
+	if e != nil {
+		l.Err(e)
+		return p, e
+	}
+	return p, p.Check(l)
 }
 
 func writeAllResults(p *param.Parameters, l *logerr.Logerr, res *route.Results, rou *route.Route) {
@@ -168,6 +231,14 @@ func emptyCommandLine(args []string, l *logerr.Logerr) bool {
 		l.Printf("\n" + version + " - " + copyright + "\n" + licnote)
 		s := " <ride parameter file>|-gpx <GPX route file>|-cfg <config file>\n"
 		l.Printf("\n\nUsage: " + args[0] + s)
+		s = " compare <ride parameter file>... [-gpx <GPX route file>]... [-cfg <config file>]\n"
+		l.Printf("       " + args[0] + s)
+		s = " fit <ride parameter file> <recorded GPX or FIT file>... [-cfg <config file>]\n"
+		l.Printf("       " + args[0] + s)
+		s = " calibrate <ride parameter file> <recorded GPX or FIT file> [-method ve|regression] [-cfg <config file>]\n"
+		l.Printf("       " + args[0] + s)
+		s = " power-table <ride parameter file> [-gpx <GPX route file>] [-cfg <config file>]\n"
+		l.Printf("       " + args[0] + s)
 		return true
 	}
 	return false
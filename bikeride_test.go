@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pekkizen/bikeride/logerr"
+	"github.com/pekkizen/bikeride/param"
+	"github.com/pekkizen/bikeride/route"
+)
+
+// TestRidesConcurrent rides the bundled routes with different power models
+// and acceleration step modes at the same time and compares the results to
+// sequential rides. Run with -race.
+func TestRidesConcurrent(t *testing.T) {
+	var (
+		routes   = []string{"Cazalla.gpx", "Cordoba.gpx", "Fuenteobe.gpx", "Loraderio.gpx"}
+		variants = [][2]int{{1, 1}, {2, 2}, {3, 3}, {4, 1}} // powerModel, acceStepMode
+		dir      = t.TempDir()
+		runs     [][]string
+	)
+	rideJSON, err := filepath.Abs("cmd/ride.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range variants {
+		cfg, err := configVariant(dir, v[0], v[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range routes {
+			runs = append(runs, []string{"bikeride", rideJSON, "-gpx", r, "-cfg", cfg})
+		}
+	}
+	want := make([]uint64, len(runs))
+	for i, args := range runs {
+		_, _, res, ok := runRide(args, logerr.New())
+		if !ok {
+			t.Fatalf("ride %v failed", args)
+		}
+		want[i] = res.CheckSum()
+	}
+	got := make([]uint64, len(runs))
+	var wg sync.WaitGroup
+	for i, args := range runs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, res, ok := runRide(args, logerr.New()); ok {
+				got[i] = res.CheckSum()
+			}
+		}()
+	}
+	wg.Wait()
+	for i := range runs {
+		if got[i] != want[i] {
+			t.Errorf("%s %s: concurrent checksum %d, sequential %d",
+				runs[i][3], filepath.Base(runs[i][5]), got[i], want[i])
+		}
+	}
+}
+
+// configVariant writes a copy of the bundled config file with the power
+// model, the acceleration step mode and no result files.
+func configVariant(dir string, model, stepMode int) (string, error) {
+	data, err := os.ReadFile("cmd/config.json")
+	if err != nil {
+		return "", err
+	}
+	var cfg map[string]any
+	if err = json.Unmarshal(data, &cfg); err != nil {
+		return "", err
+	}
+	gpxDir, err := filepath.Abs("cmd/gpx")
+	if err != nil {
+		return "", err
+	}
+	cfg["GPXdir"] = gpxDir + string(filepath.Separator)
+	cfg["resultDir"] = ""
+	cfg["routeCSV"], cfg["resultTXT"] = false, false
+	cfg["display"], cfg["logmode"] = false, -1
+	cfg["acceStepMode"] = stepMode
+	cfg["powermodel"].(map[string]any)["powerModel"] = model
+	if data, err = json.Marshal(cfg); err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, fmt.Sprintf("config_%d_%d.json", model, stepMode))
+	return file, os.WriteFile(file, data, 0644)
+}
+
+// rideVariant writes a copy of the bundled ride file with the parameter
+// groups of set changed.
+func rideVariant(dir, name string, set map[string]map[string]any) (string, error) {
+	data, err := os.ReadFile("cmd/ride.json")
+	if err != nil {
+		return "", err
+	}
+	var ride map[string]any
+	if err = json.Unmarshal(data, &ride); err != nil {
+		return "", err
+	}
+	for group, params := range set {
+		g := ride[group].(map[string]any)
+		for k, v := range params {
+			if _, ok := g[k]; !ok {
+				return "", fmt.Errorf("%s: no parameter %q", group, k)
+			}
+			g[k] = v
+		}
+	}
+	if data, err = json.Marshal(ride); err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, "ride_"+name+".json")
+	return file, os.WriteFile(file, data, 0644)
+}
+
+// TestRideOptions rides a bundled route with the ride options one at a time
+// and checks the results of each option.
+func TestRideOptions(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := configVariant(dir, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forecast := filepath.Join(dir, "forecast.csv")
+	err = os.WriteFile(forecast, []byte("time,windCourse,windSpeed\n"+
+		"2024-05-18 08:00,0,2\n2024-05-18 10:00,90,6\n2024-05-18 12:00,180,8\n"+
+		"2024-05-18 14:00,270,6\n2024-05-18 18:00,0,2\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ride := func(t *testing.T, name string, set map[string]map[string]any) (*param.Parameters, *route.Route, *route.Results, bool) {
+		t.Helper()
+		file, err := rideVariant(dir, name, set)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return runRide([]string{"bikeride", file, "-gpx", "Cazalla.gpx", "-cfg", cfg}, logerr.New())
+	}
+	_, _, base, ok := ride(t, "base", nil)
+	if !ok {
+		t.Fatal("base ride failed")
+	}
+	tests := []struct {
+		name  string
+		set   map[string]map[string]any
+		check func(t *testing.T, p *param.Parameters, rou *route.Route, res *route.Results)
+	}{
+		{"wind forecast", map[string]map[string]any{
+			"environment": {"windForecastFile": forecast},
+			"ride":        {"startTime": "2024-05-18 09:00"},
+		}, func(t *testing.T, p *param.Parameters, rou *route.Route, res *route.Results) {
+			if !rou.Converged() || res.RideRounds < 2 {
+				t.Errorf("converged %v in %d rounds", rou.Converged(), res.RideRounds)
+			}
+		}},
+		{"fatigue", map[string]map[string]any{
+			"fatigue": {"criticalPower (w)": 160},
+		}, func(t *testing.T, p *param.Parameters, rou *route.Route, res *route.Results) {
+			if !rou.Converged() || res.WPrimeMin >= 20 {
+				t.Errorf("converged %v, W' min %g kJ", rou.Converged(), res.WPrimeMin)
+			}
+		}},
+		{"group ride", map[string]map[string]any{
+			"groupRide": {"groupSize": 4, "pullFraction (%)": 25, "pullDistance (km)": 1},
+		}, func(t *testing.T, p *param.Parameters, rou *route.Route, res *route.Results) {
+			if res.TimeFront <= 0 || res.TimeDraft <= 0 ||
+				res.JriderDraft/res.TimeDraft >= res.JriderFront/res.TimeFront {
+				t.Errorf("front %g Wh in %g h, draft %g Wh in %g h",
+					res.JriderFront, res.TimeFront, res.JriderDraft, res.TimeDraft)
+			}
+			txt := resultTXT(t, p, res)
+			for label, want := range map[string]string{"Pull fraction (%)": "25", "Draft CdA (%)": "65"} {
+				if got := txtValue(txt, label); got != want {
+					t.Errorf("TXT %s %q, want %q", label, got, want)
+				}
+			}
+		}},
+		{"crosswind", map[string]map[string]any{
+			"bike": {"yawCdA [deg ratio]": [][2]float64{{0, 1}, {20, 0.9}, {90, 0.8}}},
+		}, func(t *testing.T, p *param.Parameters, rou *route.Route, res *route.Results) {
+			if res.TimeCrosswind == 0 {
+				t.Error("no crosswind time")
+			}
+		}},
+		{"humidity", map[string]map[string]any{
+			"environment": {"relativeHumidity (%)": 80},
+		}, func(t *testing.T, p *param.Parameters, rou *route.Route, res *route.Results) {
+			if res.Rho >= base.Rho {
+				t.Errorf("humid air density %g, dry %g", res.Rho, base.Rho)
+			}
+		}},
+		{"turnaround laps", map[string]map[string]any{
+			"ride": {"turnAround (km)": 10, "laps": 2},
+		}, func(t *testing.T, p *param.Parameters, rou *route.Route, res *route.Results) {
+			if math.Abs(res.DistTotal-40) > 1 {
+				t.Errorf("distance %g km, want 40 km", res.DistTotal)
+			}
+		}},
+		{"gearing", map[string]map[string]any{
+			"gearing": {"chainrings (teeth)": []int{34, 50}, "cassette (teeth)": []int{11, 13, 15, 17, 19, 21, 24, 28, 32}},
+		}, func(t *testing.T, p *param.Parameters, rou *route.Route, res *route.Results) {
+			if res.GearTopSpeed <= 0 || len(res.ClimbSpeeds) == 0 {
+				t.Errorf("top speed %g km/h, %d climbing speeds", res.GearTopSpeed, len(res.ClimbSpeeds))
+			}
+		}},
+		{"walking", map[string]map[string]any{
+			"walking": {"walkGrade (%)": 4},
+		}, func(t *testing.T, p *param.Parameters, rou *route.Route, res *route.Results) {
+			if res.DistWalk <= 0 || res.TimeWalk <= 0 {
+				t.Errorf("walked %g km in %g h", res.DistWalk, res.TimeWalk)
+			}
+		}},
+		{"eBike", map[string]map[string]any{
+			"eBike": {"assist (%)": 50, "regenBraking (%)": 50},
+		}, func(t *testing.T, p *param.Parameters, rou *route.Route, res *route.Results) {
+			if res.Jmotor <= 0 || res.Time >= base.Time {
+				t.Errorf("motor %g Wh, time %g h, base %g h", res.Jmotor, res.Time, base.Time)
+			}
+		}},
+		{"histograms", map[string]map[string]any{
+			"histograms": {"FTP (w)": 200},
+		}, func(t *testing.T, p *param.Parameters, rou *route.Route, res *route.Results) {
+			var dist float64
+			for _, d := range res.SpeedBands.Dist {
+				dist += d
+			}
+			if math.Abs(dist-res.DistTotal) > 0.01*res.DistTotal || res.PowerZones == nil {
+				t.Errorf("speed band distance %g km, route %g km", dist, res.DistTotal)
+			}
+		}},
+		{"night start", map[string]map[string]any{
+			"ride": {"startTime": "2024-06-21 23:00"},
+		}, func(t *testing.T, p *param.Parameters, rou *route.Route, res *route.Results) {
+			if res.Sunrise == "" || res.Sunset == "" || res.TimeDark <= 0 {
+				t.Errorf("sunrise %q, sunset %q, dark %g h", res.Sunrise, res.Sunset, res.TimeDark)
+			}
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p, rou, res, ok := ride(t, strings.ReplaceAll(tc.name, " ", "_"), tc.set)
+			if !ok {
+				t.Fatal("ride failed")
+			}
+			tc.check(t, p, rou, res)
+		})
+	}
+}
+
+// resultTXT returns the results TXT of the ride.
+func resultTXT(t *testing.T, p *param.Parameters, res *route.Results) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "results.txt")
+	w, err := os.Create(file)
+	if err == nil {
+		err = res.WriteTXT(p, w)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// txtValue returns the value of the results TXT line of label.
+func txtValue(txt, label string) string {
+	for _, line := range strings.Split(txt, "\n") {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(line), label); ok {
+			if f := strings.Fields(rest); len(f) > 0 {
+				return f[0]
+			}
+		}
+	}
+	return ""
+}
+
+// TestOpenRouteLaps checks that laps of a route not ending at its start
+// are rejected.
+func TestOpenRouteLaps(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := configVariant(dir, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := rideVariant(dir, "laps", map[string]map[string]any{
+		"ride": {"cutTo (km)": 10, "laps": 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, ok := runRide([]string{"bikeride", file, "-gpx", "Cazalla.gpx", "-cfg", cfg}, logerr.New()); ok {
+		t.Error("laps of an open route ridden")
+	}
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/pekkizen/bikeride/gpx"
+	"github.com/pekkizen/bikeride/logerr"
+	"github.com/pekkizen/bikeride/param"
+	"github.com/pekkizen/bikeride/route"
+
+	"github.com/pekkizen/motion"
+)
+
+/*
+The calibrate command estimates the air drag coefficient CdA and the rolling
+resistance coefficient Crr from a recorded ride with power, speed and
+elevation:
+
+	bikeride calibrate ride.json ride.fit [-method ve|regression] [-cfg config.json]
+
+The weights, the drivetrain loss, the air density, the gravity and the wind
+are from the ride parameters as in a calculated ride. The recorded track is
+set up as a route for the segment winds. A missing recorded speed is
+calculated from the sample distances and times.
+
+For a sample interval of distance d and time dt the energy balance of the
+motion.BikeCalc force model is
+
+	P·η·dt = ½·mKin·(v2² - v1²) + m·g·Δh + Crr·m·g·d + CdA·½·ρ·va·|va|·d
+
+where va is the air speed. The virtual elevation method (Chung) solves Δh
+from this and fits CdA, Crr and the start elevation to minimize the squared
+difference of the cumulative virtual elevation and the recorded elevation.
+The regression method fits CdA and Crr to the resistance forces of the
+intervals. Sample gaps, pauses and samples without power are left out and
+the virtual elevation follows the recorded elevation over them.
+
+The 95 % confidence intervals are from the standard errors of the least
+squares fit. The virtual elevation residuals are autocorrelated, so the
+intervals are too narrow and are a lower bound of the uncertainty.
+
+The results are written to the result directory as <route name>_calibrate.json
+and the recorded and virtual elevations for plotting as _calibrate.csv and
+_calibrate.svg.
+*/
+
+const (
+	ci95 = 1.96 // 95 % confidence interval of the normal distribution
+	m2km = 0.001
+)
+
+// Calibration is the calibrate command result. ElevationRMSE is the RMS
+// difference of the virtual and the recorded elevations.
+type Calibration struct {
+	Method        string
+	File          string
+	CdA           float64
+	Crr           float64
+	CdAInterval   [2]float64
+	CrrInterval   [2]float64
+	Samples       int
+	ElevationRMSE float64 // m
+	R2            float64
+	Dist          []float64 `json:"-"` // km
+	Elevation     []float64 `json:"-"` // m
+	VirtualEle    []float64 `json:"-"` // m
+}
+
+// calibInterval has the energy terms of a sample interval divided by m·g.
+type calibInterval struct {
+	valid bool
+	dh    float64 // recorded elevation change
+	work  float64 // (P·η·dt - kinetic energy change) / (m·g)
+	roll  float64 // d
+	drag  float64 // ½·ρ·va·|va|·d / (m·g)
+}
+
+func calibrate(args []string, l *logerr.Logerr) {
+	var (
+		files  []string
+		method = "ve"
+		pargs  = []string{args[0], "", "-gpx", ""}
+	)
+	for i := 2; i < len(args); i++ {
+		switch {
+		case (args[i] == "-cfg" || args[i] == "-method") && i+1 == len(args):
+			l.Err("calibrate:", args[i], "without a value")
+			return
+		case args[i] == "-cfg":
+			i++
+			pargs = append(pargs, "-cfg", args[i])
+		case args[i] == "-method":
+			i++
+			method = args[i]
+		default:
+			files = append(files, args[i])
+		}
+	}
+	if len(files) != 2 {
+		l.Err("calibrate: give a ride parameter file and a recorded GPX or FIT file")
+		return
+	}
+	if method != "ve" && method != "regression" {
+		l.Err("calibrate: method must be ve or regression")
+		return
+	}
+	pargs[1], pargs[3] = files[0], files[1]
+	p, e := readParameters(pargs, l)
+	if e != nil {
+		return
+	}
+	p.UnitConversionIn()
+	r := &p.Ride
+	r.CutFrom, r.CutTo, r.TurnAround, r.Laps = -1, -1, -1, 1
+	r.CutFromWaypoint, r.CutToWaypoint = "", ""
+	r.RoundTrip, r.ReverseRoute = false, false
+
+	recs, e := gpx.ReadRecords(p.GPXdir + p.GPXfile)
+	if e != nil {
+		l.Err(e)
+		return
+	}
+	rou, e := route.New(recordsGPX(recs), p)
+	if e != nil {
+		l.Err(p.GPXfile+":", e)
+		return
+	}
+	cal := motion.Calculator()
+	setupCalculator(cal, rou, p)
+	rou.SetupRoad(p)
+	rou.Filter()
+
+	cb, e := calibration(recs, rou, cal, p, method)
+	if e != nil {
+		l.Err("calibrate:", e)
+		return
+	}
+	cb.File = p.GPXfile
+	cb.writeAll(p, l)
+}
+
+// calibration returns the CdA and Crr estimates and the virtual elevations.
+func calibration(recs []gpx.Record, rou *route.Route, c *motion.BikeCalc,
+	p *param.Parameters, method string) (*Calibration, error) {
+
+	var (
+		cum, seg = trackSegments(rou, recs)
+		speed    = recordSpeeds(recs, cum)
+		mg       = p.Bike.Weight.Total * rou.Gravity
+		mKin     = c.WeightKin()
+		iv       = make([]calibInterval, len(recs))
+		samples  int
+	)
+	for j := 1; j < len(recs); j++ {
+		a, b := &recs[j-1], &recs[j]
+		iv[j].dh = b.Ele - a.Ele
+		if !validInterval(recs, cum, j) || a.Power < 0 || b.Power < 0 {
+			continue
+		}
+		_, _, wind := rou.SegmentRoad(seg[j])
+		dt := b.Time - a.Time
+		d := cum[j] - cum[j-1]
+		va := d/dt + wind
+		iv[j] = calibInterval{
+			valid: true,
+			dh:    iv[j].dh,
+			work:  ((a.Power+b.Power)/2*p.PowerIn*dt - 0.5*mKin*(speed[j]*speed[j]-speed[j-1]*speed[j-1])) / mg,
+			roll:  d,
+			drag:  0.5 * rou.Rho * va * math.Abs(va) * d / mg,
+		}
+		samples++
+	}
+	if samples < 3 {
+		return nil, fmt.Errorf("no recorded power and speed data")
+	}
+	var (
+		cb   = &Calibration{Method: method, Samples: samples}
+		beta []float64
+		cov  [][]float64
+		r2   float64
+		ok   bool
+	)
+	if method == "ve" {
+		beta, cov, r2, ok = virtualElevationFit(recs, iv)
+	} else {
+		beta, cov, r2, ok = forceRegression(iv)
+	}
+	if !ok {
+		return nil, fmt.Errorf("CdA and Crr are not solvable from the data")
+	}
+	cb.CdA, cb.Crr, cb.R2 = beta[0], beta[1], r2
+	cb.CdAInterval = [2]float64{cb.CdA - ci95*math.Sqrt(cov[0][0]), cb.CdA + ci95*math.Sqrt(cov[0][0])}
+	cb.CrrInterval = [2]float64{cb.Crr - ci95*math.Sqrt(cov[1][1]), cb.Crr + ci95*math.Sqrt(cov[1][1])}
+
+	h0 := recs[0].Ele
+	if method == "ve" {
+		h0 = beta[2]
+	}
+	var sum2 float64
+	ve := h0
+	for j := range recs {
+		if j > 0 {
+			ve += iv[j].virtualDh(cb.CdA, cb.Crr)
+		}
+		cb.Dist = append(cb.Dist, cum[j]*m2km)
+		cb.Elevation = append(cb.Elevation, recs[j].Ele)
+		cb.VirtualEle = append(cb.VirtualEle, ve)
+		sum2 += (ve - recs[j].Ele) * (ve - recs[j].Ele)
+	}
+	cb.ElevationRMSE = math.Sqrt(sum2 / float64(len(recs)))
+	return cb, nil
+}
+
+// virtualDh returns the virtual elevation change of the interval.
+func (v *calibInterval) virtualDh(cdA, crr float64) float64 {
+	if !v.valid {
+		return v.dh
+	}
+	return v.work - crr*v.roll - cdA*v.drag
+}
+
+// recordSpeeds returns the recorded speeds. Missing speeds are calculated
+// from the distances of the neighbour samples.
+func recordSpeeds(recs []gpx.Record, cum []float64) []float64 {
+	n := len(recs)
+	v := make([]float64, n)
+	for j := range recs {
+		if recs[j].Speed >= 0 {
+			v[j] = recs[j].Speed
+			continue
+		}
+		a, b := max(j-1, 0), min(j+1, n-1)
+		if dt := recs[b].Time - recs[a].Time; dt > 0 && dt <= 2*maxSampleGap {
+			v[j] = (cum[b] - cum[a]) / dt
+		}
+	}
+	return v
+}
+
+// virtualElevationFit fits CdA, Crr and the start elevation h0 to
+//
+//	h[j] - W[j] = h0 - Crr·R[j] - CdA·D[j]
+//
+// where W, R and D are the cumulative work, roll and drag terms. It returns
+// the coefficients, their covariance matrix and the R² of the elevations.
+func virtualElevationFit(recs []gpx.Record, iv []calibInterval) ([]float64, [][]float64, float64, bool) {
+	var (
+		n       = len(recs)
+		drag    = make([]float64, n)
+		roll    = make([]float64, n)
+		one     = make([]float64, n)
+		y       = make([]float64, n)
+		w, r, d float64
+	)
+	for j := range recs {
+		if j > 0 {
+			v := &iv[j]
+			if v.valid {
+				w += v.work
+				r += v.roll
+				d += v.drag
+			} else {
+				w += v.dh
+			}
+		}
+		drag[j], roll[j], one[j] = -d, -r, 1
+		y[j] = recs[j].Ele - w
+	}
+	return linearFit([][]float64{drag, roll, one}, y)
+}
+
+// forceRegression fits CdA and Crr to the resistance forces of the
+// intervals divided by m·g:
+//
+//	(work - dh) / d = Crr + CdA·drag / d
+func forceRegression(iv []calibInterval) ([]float64, [][]float64, float64, bool) {
+	var drag, roll, y []float64
+	for _, v := range iv {
+		if !v.valid || v.roll < 1 {
+			continue
+		}
+		drag = append(drag, v.drag/v.roll)
+		roll = append(roll, 1)
+		y = append(y, (v.work-v.dh)/v.roll)
+	}
+	return linearFit([][]float64{drag, roll}, y)
+}
+
+// linearFit returns the least squares coefficients of the columns cols to y,
+// their covariance matrix and R².
+func linearFit(cols [][]float64, y []float64) ([]float64, [][]float64, float64, bool) {
+	A, g := normalEquations(cols, y)
+	cov := invert(A)
+	if cov == nil || len(y) <= len(cols) {
+		return nil, nil, 0, false
+	}
+	beta := make([]float64, len(cols))
+	for i := range beta {
+		for k := range g {
+			beta[i] += cov[i][k] * g[k]
+		}
+	}
+	var rss, mean, tss float64
+	for k := range y {
+		mean += y[k]
+	}
+	mean /= float64(len(y))
+	for k := range y {
+		e := y[k]
+		for i := range cols {
+			e -= beta[i] * cols[i][k]
+		}
+		rss += e * e
+		tss += (y[k] - mean) * (y[k] - mean)
+	}
+	s2 := rss / float64(len(y)-len(cols))
+	for i := range cov {
+		for k := range cov[i] {
+			cov[i][k] *= s2
+		}
+	}
+	r2 := 0.0
+	if tss > 0 {
+		r2 = 1 - rss/tss
+	}
+	return beta, cov, r2, true
+}
+
+// writeAll writes the calibration JSON and the elevation CSV and SVG files.
+func (cb *Calibration) writeAll(p *param.Parameters, l *logerr.Logerr) {
+	b, e := json.MarshalIndent(cb, "", "\t")
+	if e != nil {
+		l.Err("Calibrate JSON:", e)
+		return
+	}
+	if p.Display {
+		l.Printf("%s\n", b)
+	}
+	write := func(suffix string, b []byte) {
+		w, e := writer(p, suffix)
+		if e == nil {
+			_, e = w.Write(b)
+			if e == nil {
+				e = w.Close()
+			}
+		}
+		if e != nil {
+			l.Err("Calibrate "+suffix+":", e)
+		}
+	}
+	write("_calibrate.json", b)
+	write("_calibrate.csv", cb.makeCSV(p.CSVuseTab, p.UseCR))
+	write("_calibrate.svg", cb.makeSVG())
+}
+
+// makeCSV returns the recorded and virtual elevations by distance.
+func (cb *Calibration) makeCSV(useTab, useCR bool) []byte {
+	sep, le := ",", "\n"
+	if useTab {
+		sep = "\t"
+	}
+	if useCR {
+		le = "\r\n"
+	}
+	b := []byte("distance (km)" + sep + "elevation (m)" + sep + "virtual elevation (m)" + le)
+	for j := range cb.Dist {
+		b = strconv.AppendFloat(b, cb.Dist[j], 'f', 3, 64)
+		b = append(b, sep...)
+		b = strconv.AppendFloat(b, cb.Elevation[j], 'f', 1, 64)
+		b = append(b, sep...)
+		b = strconv.AppendFloat(b, cb.VirtualEle[j], 'f', 1, 64)
+		b = append(b, le...)
+	}
+	return b
+}
+
+// makeSVG returns a plot of the recorded (black) and virtual (red)
+// elevations by distance.
+func (cb *Calibration) makeSVG() []byte {
+	const (
+		width, height = 800.0, 400.0
+		margin        = 50.0
+	)
+	var (
+		xMax = cb.Dist[len(cb.Dist)-1]
+		yMin = math.Inf(1)
+		yMax = math.Inf(-1)
+	)
+	for j := range cb.Dist {
+		yMin = min(yMin, cb.Elevation[j], cb.VirtualEle[j])
+		yMax = max(yMax, cb.Elevation[j], cb.VirtualEle[j])
+	}
+	if xMax <= 0 {
+		xMax = 1
+	}
+	if yMax-yMin < 1 {
+		yMax = yMin + 1
+	}
+	x := func(d float64) string {
+		return strconv.FormatFloat(margin+d/xMax*(width-2*margin), 'f', 1, 64)
+	}
+	y := func(h float64) string {
+		return strconv.FormatFloat(height-margin-(h-yMin)/(yMax-yMin)*(height-2*margin), 'f', 1, 64)
+	}
+	line := func(b []byte, ele []float64, color string) []byte {
+		b = append(b, `<polyline fill="none" stroke="`+color+`" stroke-width="1" points="`...)
+		for j := range cb.Dist {
+			b = append(b, x(cb.Dist[j])+","+y(ele[j])+" "...)
+		}
+		return append(b, "\"/>\n"...)
+	}
+	text := func(b []byte, xs, ys, anchor, s string) []byte {
+		return append(b, `<text x="`+xs+`" y="`+ys+`" text-anchor="`+anchor+
+			`" font-family="sans-serif" font-size="12">`+s+"</text>\n"...)
+	}
+	b := []byte(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%g" height="%g">`+"\n",
+		width, height))
+	b = append(b, `<rect x="`+x(0)+`" y="`+y(yMax)+`" width="`+ftoa(width-2*margin, 0)+
+		`" height="`+ftoa(height-2*margin, 0)+`" fill="none" stroke="gray"/>`+"\n"...)
+	b = line(b, cb.Elevation, "black")
+	b = line(b, cb.VirtualEle, "red")
+	b = text(b, x(0), ftoa(height-margin+20, 0), "start", "0")
+	b = text(b, x(xMax), ftoa(height-margin+20, 0), "end", ftoa(xMax, 1)+" km")
+	b = text(b, ftoa(margin-5, 0), y(yMin), "end", ftoa(yMin, 0))
+	b = text(b, ftoa(margin-5, 0), y(yMax), "end", ftoa(yMax, 0)+" m")
+	b = text(b, x(xMax/2), ftoa(margin-20, 0), "middle",
+		"Elevation (black) and virtual elevation (red), CdA "+ftoa(cb.CdA, 3)+", Crr "+ftoa(cb.Crr, 4))
+	return append(b, "</svg>\n"...)
+}
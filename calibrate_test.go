@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/pekkizen/bikeride/gpx"
+)
+
+const (
+	trueCdA = 0.32
+	trueCrr = 0.0055
+)
+
+// syntheticIntervals returns sample intervals of a ride at varying speeds
+// with the work of the true CdA and Crr and the recorded elevations with
+// noise of sd noise (m).
+func syntheticIntervals(n int, noise float64) ([]gpx.Record, []calibInterval) {
+	const (
+		mg  = 85 * 9.81
+		rho = 1.2
+		h0  = 100.0
+	)
+	var (
+		rnd  = rand.New(rand.NewPCG(1, 2))
+		recs = make([]gpx.Record, n)
+		iv   = make([]calibInterval, n)
+		ele  = h0
+	)
+	recs[0].Ele = h0
+	for j := 1; j < n; j++ {
+		v := 6 + 5*math.Sin(float64(j)/15) // m/s, 1 s samples
+		dh := 0.3 * math.Sin(float64(j)/40)
+		drag := 0.5 * rho * v * v * v / mg
+		iv[j] = calibInterval{
+			valid: true,
+			dh:    dh,
+			work:  dh + trueCrr*v + trueCdA*drag,
+			roll:  v,
+			drag:  drag,
+		}
+		ele += dh
+		recs[j].Ele = ele + noise*rnd.NormFloat64()
+	}
+	return recs, iv
+}
+
+func checkCalibration(t *testing.T, beta []float64, cov [][]float64, ok bool) {
+	t.Helper()
+	if !ok {
+		t.Fatal("not solvable")
+	}
+	for i, want := range []float64{trueCdA, trueCrr} {
+		ci := ci95 * math.Sqrt(cov[i][i])
+		if math.Abs(beta[i]-want) > ci {
+			t.Errorf("coefficient %d = %g ± %g, want %g", i, beta[i], ci, want)
+		}
+		if ci > 0.1*want {
+			t.Errorf("coefficient %d confidence interval ± %g too wide", i, ci)
+		}
+	}
+}
+
+// TestVirtualElevationFit recovers CdA and Crr from the elevations with
+// independent noise.
+func TestVirtualElevationFit(t *testing.T) {
+	recs, iv := syntheticIntervals(2000, 0.05)
+	beta, cov, r2, ok := virtualElevationFit(recs, iv)
+	checkCalibration(t, beta, cov, ok)
+	if r2 < 0.99 {
+		t.Errorf("R2 = %g", r2)
+	}
+}
+
+// TestForceRegression recovers CdA and Crr from the interval forces with
+// noise in the recorded elevation changes.
+func TestForceRegression(t *testing.T) {
+	recs, iv := syntheticIntervals(2000, 0.005)
+	for j := 1; j < len(iv); j++ {
+		iv[j].dh = recs[j].Ele - recs[j-1].Ele
+	}
+	beta, cov, _, ok := forceRegression(iv)
+	checkCalibration(t, beta, cov, ok)
+}
+
+func TestLinearFitExact(t *testing.T) {
+	x := []float64{0, 1, 2, 3, 4}
+	one := []float64{1, 1, 1, 1, 1}
+	y := []float64{1, 3, 5, 7, 9} // 1 + 2x
+	beta, _, r2, ok := linearFit([][]float64{x, one}, y)
+	if !ok || math.Abs(beta[0]-2) > 1e-12 || math.Abs(beta[1]-1) > 1e-12 || math.Abs(r2-1) > 1e-12 {
+		t.Errorf("linearFit = %v, R2 %g, ok %v", beta, r2, ok)
+	}
+	if _, _, _, ok := linearFit([][]float64{x, one}, y[:2]); ok {
+		t.Error("linearFit: no degrees of freedom solved")
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pekkizen/bikeride/logerr"
+	"github.com/pekkizen/bikeride/param"
+	"github.com/pekkizen/bikeride/route"
+)
+
+/*
+The compare command calculates two or more ride variants and writes the
+Results fields side by side with the differences of the numeric fields
+and the histogram bins to the first variant. The variants are either ride
+parameter files with the same route or routes with the same ride parameter
+file:
+
+	bikeride compare ride1.json ride2.json [-gpx route.gpx] [-cfg config.json]
+	bikeride compare ride.json -gpx route1.gpx -gpx route2.gpx [-cfg config.json]
+
+The comparison is written to the result directory of the first variant as
+<route name>_compare.txt and <route name>_compare.json.
+*/
+
+// Comparison is the compare command result.
+type Comparison struct {
+	Runs   []CompareRun
+	Fields []CompareField
+}
+
+// CompareRun is a compared ride variant.
+type CompareRun struct {
+	RideJSON string
+	GPXfile  string
+}
+
+// CompareField is a Results field of the compared variants. Diff and
+// DiffPercent are the differences to the first variant. The string and
+// slice fields are in Text without differences.
+type CompareField struct {
+	Name        string
+	Values      []float64 `json:",omitempty"`
+	Diff        []float64 `json:",omitempty"`
+	DiffPercent []float64 `json:",omitempty"`
+	Text        []string  `json:",omitempty"`
+}
+
+func compare(args []string, l *logerr.Logerr) {
+	variants, err := compareVariants(args)
+	if err != nil {
+		l.Err("compare:", err)
+		return
+	}
+	var (
+		cmp     Comparison
+		results []*route.Results
+		first   *param.Parameters
+	)
+	for _, v := range variants {
+		p, _, res, ok := runRide(v, l)
+		if !ok {
+			return
+		}
+		if first == nil {
+			first = p
+		}
+		cmp.Runs = append(cmp.Runs, CompareRun{RideJSON: p.RideJSON, GPXfile: p.GPXfile})
+		results = append(results, res)
+	}
+	cmp.diffResults(results)
+
+	b := cmp.makeTXT(first.UseCR)
+	if first.Display {
+		l.Printf("%s", b)
+	}
+	w, e := writer(first, "_compare.txt")
+	if e == nil {
+		_, e = w.Write(b)
+		if e == nil {
+			e = w.Close()
+		}
+	}
+	if e != nil {
+		l.Err("Compare TXT:", e)
+	}
+	w, e = writer(first, "_compare.json")
+	if e == nil {
+		b, e = json.MarshalIndent(&cmp, "", "\t")
+		if e == nil {
+			_, e = w.Write(b)
+		}
+		if e == nil {
+			e = w.Close()
+		}
+	}
+	if e != nil {
+		l.Err("Compare JSON:", e)
+	}
+}
+
+// compareVariants returns the command line args of the compared variants.
+func compareVariants(args []string) ([][]string, error) {
+	var jsons, gpxs []string
+	cfg := ""
+	for i := 2; i < len(args); i++ {
+		switch {
+		case (args[i] == "-gpx" || args[i] == "-cfg") && i+1 == len(args):
+			return nil, fmt.Errorf("%s without a file", args[i])
+		case args[i] == "-gpx":
+			i++
+			gpxs = append(gpxs, args[i])
+		case args[i] == "-cfg":
+			i++
+			cfg = args[i]
+		default:
+			jsons = append(jsons, args[i])
+		}
+	}
+	variant := func(rideJSON, gpx string) []string {
+		v := []string{args[0], rideJSON}
+		if gpx != "" {
+			v = append(v, "-gpx", gpx)
+		}
+		if cfg != "" {
+			v = append(v, "-cfg", cfg)
+		}
+		return v
+	}
+	var variants [][]string
+	switch {
+	case len(jsons) >= 2 && len(gpxs) <= 1:
+		gpx := ""
+		if len(gpxs) == 1 {
+			gpx = gpxs[0]
+		}
+		for _, j := range jsons {
+			variants = append(variants, variant(j, gpx))
+		}
+	case len(jsons) == 1 && len(gpxs) >= 2:
+		for _, g := range gpxs {
+			variants = append(variants, variant(jsons[0], g))
+		}
+	default:
+		return nil, fmt.Errorf("give two or more ride parameter files or GPX files")
+	}
+	return variants, nil
+}
+
+// diffResults sets the Results fields of the variants and the differences
+// of the numeric fields to the first variant. The histogram bins are
+// numeric fields.
+func (cmp *Comparison) diffResults(results []*route.Results) {
+	t := reflect.TypeOf(*results[0])
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		values := make([]reflect.Value, len(results))
+		for k, r := range results {
+			values[k] = reflect.ValueOf(*r).Field(i)
+		}
+		switch v := values[0]; {
+		case v.Kind() == reflect.Float64 || v.Kind() == reflect.Int:
+			f := CompareField{Name: field.Name}
+			for _, v := range values {
+				f.Values = append(f.Values, number(v))
+			}
+			cmp.addNumeric(f)
+		case v.Type() == reflect.TypeOf((*route.Histogram)(nil)):
+			cmp.addHistograms(field.Name, values)
+		default:
+			f := CompareField{Name: field.Name}
+			for _, v := range values {
+				f.Text = append(f.Text, text(v))
+			}
+			cmp.Fields = append(cmp.Fields, f)
+		}
+	}
+}
+
+func number(v reflect.Value) float64 {
+	if v.Kind() == reflect.Int {
+		return float64(v.Int())
+	}
+	return v.Float()
+}
+
+// text returns a string or a slice field value as text.
+func text(v reflect.Value) string {
+	if v.Kind() == reflect.String {
+		return v.String()
+	}
+	return fmt.Sprintf("%+v", v.Interface())
+}
+
+// addNumeric adds the numeric field f with the differences.
+func (cmp *Comparison) addNumeric(f CompareField) {
+	base := f.Values[0]
+	for _, x := range f.Values {
+		d, pct := x-base, 0.0
+		if base != 0 {
+			pct = 100 * d / math.Abs(base)
+		}
+		f.Diff = append(f.Diff, d)
+		f.DiffPercent = append(f.DiffPercent, pct)
+	}
+	cmp.Fields = append(cmp.Fields, f)
+}
+
+// addHistograms adds the histogram bin limits as text and the time,
+// distance and energy of the bins as numeric fields, e.g. SpeedBands.Time[2].
+// A missing histogram or bin is zero.
+func (cmp *Comparison) addHistograms(name string, values []reflect.Value) {
+	var (
+		hs     = make([]*route.Histogram, len(values))
+		limits = CompareField{Name: name + ".Limits"}
+		bins   int
+	)
+	for k, v := range values {
+		h := v.Interface().(*route.Histogram)
+		if h == nil {
+			h = &route.Histogram{}
+		}
+		hs[k] = h
+		bins = max(bins, len(h.Time))
+		limits.Text = append(limits.Text, fmt.Sprint(h.Limits))
+	}
+	if bins == 0 {
+		return
+	}
+	cmp.Fields = append(cmp.Fields, limits)
+	columns := []struct {
+		name string
+		bins func(h *route.Histogram) []float64
+	}{
+		{"Time", func(h *route.Histogram) []float64 { return h.Time }},
+		{"Dist", func(h *route.Histogram) []float64 { return h.Dist }},
+		{"Energy", func(h *route.Histogram) []float64 { return h.Energy }},
+	}
+	for _, c := range columns {
+		for j := range bins {
+			f := CompareField{Name: name + "." + c.name + "[" + strconv.Itoa(j) + "]"}
+			for _, h := range hs {
+				var x float64
+				if b := c.bins(h); j < len(b) {
+					x = b[j]
+				}
+				f.Values = append(f.Values, x)
+			}
+			cmp.addNumeric(f)
+		}
+	}
+}
+
+// makeTXT returns the comparison as tab separated text.
+func (cmp *Comparison) makeTXT(useCR bool) []byte {
+	le := "\n"
+	if useCR {
+		le = "\r\n"
+	}
+	fmtF := func(b []byte, x float64) []byte {
+		b = append(b, '\t')
+		return strconv.AppendFloat(b, x, 'g', 6, 64)
+	}
+	b := []byte("Compare" + le)
+	for i, r := range cmp.Runs {
+		b = append(b, "\t"+strconv.Itoa(i+1)+"\t"+r.RideJSON+"\t"+r.GPXfile+le...)
+	}
+	b = append(b, le+"Field\t1"...)
+	for i := 2; i <= len(cmp.Runs); i++ {
+		n := strconv.Itoa(i)
+		b = append(b, "\t"+n+"\t"+n+"-1\t"+n+"-1 (%)"...)
+	}
+	b = append(b, le...)
+	for _, f := range cmp.Fields {
+		b = append(b, f.Name+strings.Repeat(" ", max(0, 20-len(f.Name)))...)
+		if f.Text != nil {
+			b = append(b, "\t"+f.Text[0]...)
+			for _, x := range f.Text[1:] {
+				b = append(b, "\t"+x+"\t\t"...)
+			}
+			b = append(b, le...)
+			continue
+		}
+		b = fmtF(b, f.Values[0])
+		for i := 1; i < len(f.Values); i++ {
+			b = fmtF(b, f.Values[i])
+			b = fmtF(b, f.Diff[i])
+			b = append(b, '\t')
+			b = strconv.AppendFloat(b, f.DiffPercent[i], 'f', 1, 64)
+		}
+		b = append(b, le...)
+	}
+	return b
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/pekkizen/bikeride/route"
+)
+
+func TestDiffResults(t *testing.T) {
+	a := &route.Results{
+		Time:       2,
+		Segments:   100,
+		Sunrise:    "6:02",
+		Stops:      []route.Stop{{Dist: 30, Duration: 15, Waypoint: "Café"}},
+		SpeedBands: &route.Histogram{Limits: []float64{20}, Time: []float64{1, 1}, Dist: []float64{15, 25}, Energy: []float64{100, 200}},
+	}
+	b := &route.Results{
+		Time:     2.5,
+		Segments: 100,
+		Sunrise:  "6:03",
+	}
+	var cmp Comparison
+	cmp.Runs = make([]CompareRun, 2)
+	cmp.diffResults([]*route.Results{a, b})
+
+	fields := make(map[string]CompareField)
+	for _, f := range cmp.Fields {
+		fields[f.Name] = f
+	}
+	if f := fields["Time"]; len(f.Diff) != 2 || f.Diff[1] != 0.5 || math.Abs(f.DiffPercent[1]-25) > 1e-12 {
+		t.Errorf("Time %+v", f)
+	}
+	if f := fields["Sunrise"]; len(f.Text) != 2 || f.Text[1] != "6:03" || f.Values != nil {
+		t.Errorf("Sunrise %+v", f)
+	}
+	if f := fields["Stops"]; len(f.Text) != 2 || !strings.Contains(f.Text[0], "Café") || f.Text[1] != "[]" {
+		t.Errorf("Stops %+v", f)
+	}
+	if f := fields["SpeedBands.Dist[1]"]; len(f.Values) != 2 || f.Values[0] != 25 || f.Diff[1] != -25 {
+		t.Errorf("SpeedBands.Dist[1] %+v", f)
+	}
+	if _, ok := fields["PowerZones.Time[0]"]; ok {
+		t.Error("bins of missing histograms")
+	}
+	for _, name := range []string{"ClimbSpeeds", "Waypoints", "Feeds", "Foods", "SpeedSchedule", "StartClock", "SpeedBands.Limits"} {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("no field %s", name)
+		}
+	}
+	txt := string(cmp.makeTXT(false))
+	if !strings.Contains(txt, "Sunrise") || !strings.Contains(txt, "\t6:02\t6:03\t\t\n") {
+		t.Errorf("TXT text row missing:\n%s", txt)
+	}
+}
@@ -0,0 +1,560 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+
+	"github.com/pekkizen/bikeride/gpx"
+	"github.com/pekkizen/bikeride/logerr"
+	"github.com/pekkizen/bikeride/param"
+	"github.com/pekkizen/bikeride/power"
+	"github.com/pekkizen/bikeride/route"
+
+	"github.com/pekkizen/motion"
+)
+
+/*
+The fit command fits the power model coefficients of the ride parameter
+file to recorded rides with power data:
+
+	bikeride fit ride.json ride1.gpx ride2.fit [-cfg config.json]
+
+The recorded GPX or FIT files are read from the GPX directory. Each recorded
+track is set up and filtered as a route by the ride parameters, so the
+grades and the winds of the road segments are the same as in a calculated
+ride. The recorded samples are mapped to the road segments by the distance
+and the segment power is the mean recorded power over the segment riding
+time. Pauses, sample gaps over maxSampleGap and speeds under minSampleSpeed
+are left out. The route composition parameters are not used.
+
+The coefficients are fitted by the Levenberg-Marquardt method to minimize
+the riding time weighted squared error of the model power flatGroundPower x
+Ratio(grade, wind) to the segment power. The fitted coefficients are
+
+	powerModel 1-4:  flatGroundPower, uphillPower, downhillPower,
+	                 tailWindPower, headWindPower and the grade and wind
+	                 cross terms CUT, CUH, CDT and CDH
+	powerModel 3, 4: and ExpUphill and ExpDownhill
+
+The uphill and downhill power grades are kept at the values of the ride
+parameters and coefficients without data, e.g. the wind powers of windless
+rides, are not fitted. The downhill cross terms CDT and CDH are set by
+downhillTailwindPower and downhillHeadwindPower, or their defaults, and are
+reported as not fitted. The ratio table of powerModel 5 is not fitted.
+
+The powermodel section and the fit statistics are written to the result
+directory as <route name>_fit.json. The section has the flat ground speed
+of the fitted power, so that the air drag coefficient is kept.
+*/
+
+const (
+	maxSampleGap   = 30.0 // s
+	minSampleSpeed = 1.0  // m/s
+	minFitSegTime  = 1.0  // s
+	maxFitRounds   = 100
+	fitTol         = 1e-9
+	degreeDist     = 6371000 * math.Pi / 180 // m
+)
+
+// PowerFit is the fit command result.
+type PowerFit struct {
+	Powermodel FitPowermodel `json:"powermodel"`
+	Statistics FitStatistics `json:"fitStatistics"`
+}
+
+// FitPowermodel is the fitted powermodel section of the ride parameters.
+type FitPowermodel struct {
+	PowermodelType   int     `json:"powerModel"`
+	FlatSpeed        float64 `json:"flatGroundSpeed (km/h)"`
+	FlatPower        float64 `json:"flatGroundPower (w)"`
+	UphillPower      float64 `json:"uphillPower (w)"`
+	UphillPowerGrade float64 `json:"uphillPowerGrade (%)"`
+	UphillPowerSpeed float64 `json:"uphillPowerSpeed (km/h)"`
+	VerticalUpSpeed  float64 `json:"verticalUpSpeed (m/h)"`
+	DownhillPower    float64 `json:"downhillPower (%)"`
+	TailWindPower    float64 `json:"tailWindPower (%)"`
+	HeadWindPower    float64 `json:"headWindPower (%)"`
+	ExpUphill        float64 `json:",omitempty"`
+	ExpDownhill      float64 `json:",omitempty"`
+	CUT              float64
+	CUH              float64
+	CDT              float64
+	CDH              float64
+}
+
+// FitStatistics are the goodness of fit statistics. Powers are in W and
+// StdErr has the standard errors of the fitted coefficients.
+type FitStatistics struct {
+	Files      []string
+	Segments   int
+	Time       float64 // h
+	MeanPower  float64
+	RMSE       float64
+	Bias       float64 // mean model power - recorded power
+	R2         float64
+	Iterations int
+	Converged  bool
+	NotFitted  []string
+	StdErr     map[string]float64
+}
+
+// fitObs is the riding time and the mean power of a road segment.
+type fitObs struct{ grade, wind, power, time float64 }
+
+// fitCoef is a fitted coefficient. It is fitted as the log of the value.
+type fitCoef struct {
+	name  string
+	value *float64
+	unit  float64 // output unit conversion
+}
+
+func fitPower(args []string, l *logerr.Logerr) {
+	if len(args) < 4 {
+		l.Err("fit: give a ride parameter file and recorded GPX or FIT files")
+		return
+	}
+	var files []string
+	pargs := []string{args[0], args[2], "-gpx", ""}
+	for i := 3; i < len(args); i++ {
+		if args[i] == "-cfg" && i+1 < len(args) {
+			i++
+			pargs = append(pargs, "-cfg", args[i])
+			continue
+		}
+		files = append(files, args[i])
+	}
+	if len(files) == 0 {
+		l.Err("fit: no recorded GPX or FIT files")
+		return
+	}
+	pargs[3] = files[0]
+	p, e := readParameters(pargs, l)
+	if e != nil {
+		return
+	}
+	switch p.Powermodel.PowermodelType {
+	case 5:
+		l.Err("fit: the ratio table of powerModel 5 is not fitted")
+		return
+	case 6:
+		l.Err("fit: the speed schedule of powerModel 6 is not fitted")
+		return
+	}
+	p.UnitConversionIn()
+	r := &p.Ride
+	r.CutFrom, r.CutTo, r.TurnAround, r.Laps = -1, -1, -1, 1
+	r.CutFromWaypoint, r.CutToWaypoint = "", ""
+	r.RoundTrip, r.ReverseRoute = false, false
+
+	var (
+		cal = motion.Calculator()
+		gen = power.RatioGenerator()
+		obs []fitObs
+	)
+	for i, f := range files {
+		recs, e := gpx.ReadRecords(p.GPXdir + f)
+		if e != nil {
+			l.Err(e)
+			return
+		}
+		rou, e := route.New(recordsGPX(recs), p)
+		if e != nil {
+			l.Err(f+":", e)
+			return
+		}
+		if i == 0 {
+			if e := setupSystem(cal, gen, p, rou, l); e != nil {
+				l.Err(e)
+				return
+			}
+		}
+		rou.SetupRoad(p)
+		rou.Filter()
+		obs = append(obs, segmentObs(rou, recs, p.PowerIn)...)
+	}
+	if len(obs) == 0 {
+		l.Err("fit: no recorded power data")
+		return
+	}
+	res, e := fitPowerModel(obs, cal, gen, p)
+	if e != nil {
+		l.Err("fit:", e)
+		return
+	}
+	res.Statistics.Files = files
+
+	b, e := json.MarshalIndent(&res, "", "\t")
+	if e != nil {
+		l.Err("Fit JSON:", e)
+		return
+	}
+	if p.Display {
+		l.Printf("%s\n", b)
+	}
+	w, e := writer(p, "_fit.json")
+	if e == nil {
+		_, e = w.Write(b)
+		if e == nil {
+			e = w.Close()
+		}
+	}
+	if e != nil {
+		l.Err("Fit JSON:", e)
+	}
+}
+
+// recordsGPX returns the recorded samples as a GPX track.
+func recordsGPX(recs []gpx.Record) *gpx.GPX {
+	tps := make([]gpx.Trkpt, len(recs))
+	for i, r := range recs {
+		tps[i] = gpx.Trkpt{Lat: r.Lat, Lon: r.Lon, Ele: r.Ele}
+	}
+	return &gpx.GPX{Trks: []gpx.Trk{{Trksegs: []gpx.Trkseg{{Trkpts: tps}}}}}
+}
+
+// trackSegments returns the cumulative distances (m) of the recorded
+// samples and the road segments of the sample intervals. The recorded track
+// distances are scaled to the route distance and the interval j-1..j is in
+// seg[j], the segment of its middle point.
+func trackSegments(rou *route.Route, recs []gpx.Record) (cum []float64, seg []int) {
+	var (
+		n    = rou.Segments()
+		ends = make([]float64, n)
+		dist float64
+	)
+	for i := range n {
+		d, _, _ := rou.SegmentRoad(i + 1)
+		dist += d
+		ends[i] = dist
+	}
+	cum = make([]float64, len(recs))
+	seg = make([]int, len(recs))
+	for j := 1; j < len(recs); j++ {
+		a, b := &recs[j-1], &recs[j]
+		dLat := (b.Lat - a.Lat) * degreeDist
+		dLon := (b.Lon - a.Lon) * degreeDist * math.Cos((a.Lat+b.Lat)/2*math.Pi/180)
+		cum[j] = cum[j-1] + math.Sqrt(dLat*dLat+dLon*dLon)
+	}
+	if cum[len(cum)-1] > 0 {
+		scale := dist / cum[len(cum)-1]
+		for j := range cum {
+			cum[j] *= scale
+		}
+	}
+	for j := 1; j < len(recs); j++ {
+		seg[j] = min(sort.SearchFloat64s(ends, (cum[j]+cum[j-1])/2), n-1) + 1
+	}
+	return cum, seg
+}
+
+// validInterval reports whether the sample interval j-1..j is ridden.
+func validInterval(recs []gpx.Record, cum []float64, j int) bool {
+	dt := recs[j].Time - recs[j-1].Time
+	return dt > 0 && dt <= maxSampleGap && cum[j]-cum[j-1] >= minSampleSpeed*dt
+}
+
+// segmentObs returns the riding times and the mean powers of the road
+// segments. The powers are multiplied by powerIn.
+func segmentObs(rou *route.Route, recs []gpx.Record, powerIn float64) []fitObs {
+	var (
+		n        = rou.Segments()
+		energy   = make([]float64, n+1)
+		time     = make([]float64, n+1)
+		cum, seg = trackSegments(rou, recs)
+	)
+	for j := 1; j < len(recs); j++ {
+		a, b := &recs[j-1], &recs[j]
+		if !validInterval(recs, cum, j) || a.Power < 0 || b.Power < 0 {
+			continue
+		}
+		dt := b.Time - a.Time
+		energy[seg[j]] += (a.Power + b.Power) / 2 * dt
+		time[seg[j]] += dt
+	}
+	var obs []fitObs
+	for k := 1; k <= n; k++ {
+		if time[k] < minFitSegTime {
+			continue
+		}
+		_, grade, wind := rou.SegmentRoad(k)
+		obs = append(obs, fitObs{grade, wind, energy[k] / time[k] * powerIn, time[k]})
+	}
+	return obs
+}
+
+// fitPowerModel fits the power model coefficients of p to the observations
+// and returns the fitted powermodel section and the fit statistics.
+func fitPowerModel(obs []fitObs, c *motion.BikeCalc, gen *power.Generator,
+	p *param.Parameters) (PowerFit, error) {
+
+	q := &p.Powermodel
+	coefs := []fitCoef{
+		{name: "flatGroundPower", value: &q.FlatPower, unit: p.PowerOut},
+		{name: "uphillPower", value: &q.UphillPower, unit: p.PowerOut},
+		{name: "downhillPower", value: &q.DownhillPower, unit: 1},
+		{name: "tailWindPower", value: &q.TailWindPower, unit: 1},
+		{name: "headWindPower", value: &q.HeadWindPower, unit: 1},
+		{name: "CUT", value: &q.CUT, unit: 1},
+		{name: "CUH", value: &q.CUH, unit: 1},
+		{name: "CDT", value: &q.CDT, unit: 1},
+		{name: "CDH", value: &q.CDH, unit: 1},
+	}
+	if q.PowermodelType == 3 || q.PowermodelType == 4 {
+		coefs = append(coefs,
+			fitCoef{name: "ExpUphill", value: &q.ExpUphill, unit: 1},
+			fitCoef{name: "ExpDownhill", value: &q.ExpDownhill, unit: 1})
+	}
+	var (
+		res  PowerFit
+		st   = &res.Statistics
+		x    []float64 // log values of the fitted coefficients
+		free []*fitCoef
+		err  error
+	)
+	residuals := func(x []float64) []float64 {
+		for i, f := range free {
+			*f.value = math.Exp(x[i])
+		}
+		if e := setupPowerModel(gen, p); e != nil && err == nil {
+			err = e
+		}
+		r := make([]float64, len(obs))
+		for i, o := range obs {
+			r[i] = math.Sqrt(o.time) * (q.FlatPower*gen.Ratio(o.grade, o.wind) - o.power)
+		}
+		return r
+	}
+	for i := range coefs {
+		if *coefs[i].value <= 0 { // not in use
+			st.NotFitted = append(st.NotFitted, coefs[i].name)
+			continue
+		}
+		free = append(free, &coefs[i])
+		x = append(x, math.Log(*coefs[i].value))
+	}
+	// coefficients without sensitivity to the data are not fitted
+	J := jacobian(residuals, x)
+	k := 0
+	for i, f := range free {
+		if sumSquares(J[i]) < 1e-12 {
+			st.NotFitted = append(st.NotFitted, f.name)
+			continue
+		}
+		free[k], x[k] = f, x[i]
+		k++
+	}
+	free, x = free[:k], x[:k]
+
+	var cov [][]float64
+	x, st.Iterations, st.Converged, cov = levenbergMarquardt(residuals, x)
+	r := residuals(x)
+	if err != nil {
+		return res, err
+	}
+
+	var sumT, sumP, sumE, sumE2, sumP2 float64
+	for i, o := range obs {
+		e := r[i] / math.Sqrt(o.time)
+		sumT += o.time
+		sumP += o.time * o.power
+		sumE += o.time * e
+		sumE2 += o.time * e * e
+	}
+	mean := sumP / sumT
+	for _, o := range obs {
+		sumP2 += o.time * (o.power - mean) * (o.power - mean)
+	}
+	po := p.PowerOut
+	st.Segments = len(obs)
+	st.Time = sumT / 3600
+	st.MeanPower = mean * po
+	st.RMSE = math.Sqrt(sumE2/sumT) * po
+	st.Bias = sumE / sumT * po
+	if sumP2 > 0 {
+		st.R2 = 1 - sumE2/sumP2
+	}
+	st.StdErr = map[string]float64{}
+	if dof := len(obs) - len(x); dof > 0 && cov != nil {
+		s2 := sumSquares(r) / float64(dof)
+		for i, f := range free {
+			st.StdErr[f.name] = *f.value * f.unit * math.Sqrt(s2*cov[i][i])
+		}
+	}
+	m := &res.Powermodel
+	m.PowermodelType = q.PowermodelType
+	m.FlatSpeed = c.FlatSpeed(q.FlatPower) * ms2kmh
+	m.FlatPower = q.FlatPower * po
+	m.UphillPower = q.UphillPower * po
+	m.UphillPowerGrade = q.UphillPowerGrade * 100
+	m.UphillPowerSpeed = -1
+	m.VerticalUpSpeed = -1
+	m.DownhillPower = q.DownhillPower
+	m.TailWindPower = q.TailWindPower
+	m.HeadWindPower = q.HeadWindPower
+	if q.PowermodelType == 3 || q.PowermodelType == 4 {
+		m.ExpUphill = q.ExpUphill
+		m.ExpDownhill = q.ExpDownhill
+	}
+	m.CUT, m.CUH, m.CDT, m.CDH = q.CUT, q.CUH, q.CDT, q.CDH
+	return res, nil
+}
+
+// levenbergMarquardt minimizes the sum of squares of the residuals from x.
+// It returns the solution, the iteration count, the convergence and the
+// inverse of J'J at the solution, nil if singular.
+func levenbergMarquardt(residuals func([]float64) []float64, x []float64) (
+	[]float64, int, bool, [][]float64) {
+
+	var (
+		n      = len(x)
+		r      = residuals(x)
+		cost   = sumSquares(r)
+		lambda = 1e-3
+		iter   int
+		conv   bool
+	)
+	if n == 0 {
+		return x, 0, true, nil
+	}
+	for iter = 1; iter <= maxFitRounds && !conv; iter++ {
+		J := jacobian(residuals, x)
+		A, g := normalEquations(J, r)
+		for {
+			B := make([][]float64, n)
+			for i := range n {
+				B[i] = append([]float64(nil), A[i]...)
+				B[i][i] += lambda * (A[i][i] + 1e-12)
+			}
+			step, ok := solveLinear(B, append([]float64(nil), g...))
+			if !ok {
+				lambda *= 10
+				continue
+			}
+			y := make([]float64, n)
+			for i := range n {
+				y[i] = x[i] - step[i]
+			}
+			ry := residuals(y)
+			if c := sumSquares(ry); c < cost {
+				conv = cost-c <= fitTol*cost || sumSquares(step) <= fitTol*fitTol
+				x, r, cost = y, ry, c
+				lambda = max(lambda/10, 1e-12)
+				break
+			}
+			if lambda *= 10; lambda > 1e12 {
+				conv = true
+				break
+			}
+		}
+	}
+	J := jacobian(residuals, x)
+	A, _ := normalEquations(J, r)
+	residuals(x) // sets the solution coefficients
+	return x, iter - 1, conv, invert(A)
+}
+
+// jacobian returns the forward difference jacobian of the residuals.
+// J[i] is the column of x[i].
+func jacobian(residuals func([]float64) []float64, x []float64) [][]float64 {
+	const h = 1e-6
+	r := residuals(x)
+	J := make([][]float64, len(x))
+	y := append([]float64(nil), x...)
+	for i := range x {
+		y[i] = x[i] + h
+		ri := residuals(y)
+		y[i] = x[i]
+		J[i] = make([]float64, len(r))
+		for k := range r {
+			J[i][k] = (ri[k] - r[k]) / h
+		}
+	}
+	return J
+}
+
+// normalEquations returns J'J and J'r.
+func normalEquations(J [][]float64, r []float64) ([][]float64, []float64) {
+	n := len(J)
+	A := make([][]float64, n)
+	g := make([]float64, n)
+	for i := range n {
+		A[i] = make([]float64, n)
+		for j := range n {
+			for k := range r {
+				A[i][j] += J[i][k] * J[j][k]
+			}
+		}
+		for k := range r {
+			g[i] += J[i][k] * r[k]
+		}
+	}
+	return A, g
+}
+
+// solveLinear solves A x = b by Gaussian elimination with partial pivoting.
+// A and b are changed.
+func solveLinear(A [][]float64, b []float64) ([]float64, bool) {
+	n := len(b)
+	for c := range n {
+		p := c
+		for i := c + 1; i < n; i++ {
+			if math.Abs(A[i][c]) > math.Abs(A[p][c]) {
+				p = i
+			}
+		}
+		if math.Abs(A[p][c]) < 1e-300 {
+			return nil, false
+		}
+		A[c], A[p] = A[p], A[c]
+		b[c], b[p] = b[p], b[c]
+		for i := c + 1; i < n; i++ {
+			f := A[i][c] / A[c][c]
+			for j := c; j < n; j++ {
+				A[i][j] -= f * A[c][j]
+			}
+			b[i] -= f * b[c]
+		}
+	}
+	x := make([]float64, n)
+	for i := n - 1; i >= 0; i-- {
+		s := b[i]
+		for j := i + 1; j < n; j++ {
+			s -= A[i][j] * x[j]
+		}
+		x[i] = s / A[i][i]
+	}
+	return x, true
+}
+
+// invert returns the inverse of A, or nil if A is singular.
+func invert(A [][]float64) [][]float64 {
+	n := len(A)
+	inv := make([][]float64, n)
+	for j := range n {
+		B := make([][]float64, n)
+		for i := range n {
+			B[i] = append([]float64(nil), A[i]...)
+		}
+		e := make([]float64, n)
+		e[j] = 1
+		col, ok := solveLinear(B, e)
+		if !ok {
+			return nil
+		}
+		for i := range n {
+			if inv[i] == nil {
+				inv[i] = make([]float64, n)
+			}
+			inv[i][j] = col[i]
+		}
+	}
+	return inv
+}
+
+func sumSquares(x []float64) (s float64) {
+	for _, v := range x {
+		s += v * v
+	}
+	return
+}
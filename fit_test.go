@@ -0,0 +1,197 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/pekkizen/bikeride/gpx"
+	"github.com/pekkizen/bikeride/logerr"
+	"github.com/pekkizen/bikeride/param"
+	"github.com/pekkizen/bikeride/power"
+	"github.com/pekkizen/bikeride/route"
+
+	"github.com/pekkizen/motion"
+)
+
+func TestSolveLinear(t *testing.T) {
+	A := [][]float64{{0, 2, 1}, {1, 1, 1}, {2, 1, 3}}
+	b := []float64{7, 6, 13} // x = 1, 2, 3
+	x, ok := solveLinear(A, b)
+	if !ok {
+		t.Fatal("solveLinear: singular")
+	}
+	for i, want := range []float64{1, 2, 3} {
+		if math.Abs(x[i]-want) > 1e-12 {
+			t.Errorf("x[%d] = %g, want %g", i, x[i], want)
+		}
+	}
+	if _, ok := solveLinear([][]float64{{1, 2}, {2, 4}}, []float64{1, 2}); ok {
+		t.Error("solveLinear: singular matrix solved")
+	}
+}
+
+func TestInvert(t *testing.T) {
+	A := [][]float64{{4, 1, 0}, {1, 3, 1}, {0, 1, 2}}
+	inv := invert(A)
+	if inv == nil {
+		t.Fatal("invert: singular")
+	}
+	for i := range A {
+		for j := range A {
+			var s float64
+			for k := range A {
+				s += A[i][k] * inv[k][j]
+			}
+			if want := float64(btoi(i == j)); math.Abs(s-want) > 1e-12 {
+				t.Errorf("(A inv)[%d][%d] = %g, want %g", i, j, s, want)
+			}
+		}
+	}
+	if invert([][]float64{{1, 2}, {2, 4}}) != nil {
+		t.Error("invert: singular matrix inverted")
+	}
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// TestLevenbergMarquardt fits y = a exp(b t) to exact data.
+func TestLevenbergMarquardt(t *testing.T) {
+	const a, b = 2.5, -0.7
+	residuals := func(x []float64) []float64 {
+		r := make([]float64, 20)
+		for i := range r {
+			ti := float64(i) / 4
+			r[i] = x[0]*math.Exp(x[1]*ti) - a*math.Exp(b*ti)
+		}
+		return r
+	}
+	x, iter, conv, cov := levenbergMarquardt(residuals, []float64{1, 0})
+	if !conv || cov == nil {
+		t.Fatalf("not converged in %d iterations", iter)
+	}
+	if math.Abs(x[0]-a) > 1e-5 || math.Abs(x[1]-b) > 1e-5 {
+		t.Errorf("fit %v, want [%g %g]", x, a, b)
+	}
+}
+
+// fitParameters returns the bundled ride parameters with the simple linear
+// power model.
+func fitParameters(t *testing.T) *param.Parameters {
+	args := []string{"bikeride", "cmd/ride.json", "-cfg", "cmd/config.json", "-gpx", "fit.gpx"}
+	l := logerr.New()
+	p, err := param.New(args, l)
+	if err == nil {
+		err = p.Check(l)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.UnitConversionIn()
+	q := &p.Powermodel
+	q.PowermodelType = 2
+	q.UphillPowerGrade = 0.08
+	q.DownhillPowerGrade = -0.05
+	return p
+}
+
+// TestFitPowerModel recovers the coefficients of the simple linear power
+// model from the exact model powers.
+func TestFitPowerModel(t *testing.T) {
+	var (
+		p    = fitParameters(t)
+		q    = &p.Powermodel
+		gen  = power.RatioGenerator()
+		obs  []fitObs
+		want = []struct {
+			name  string
+			value *float64
+			x     float64
+		}{
+			{"flatGroundPower", &q.FlatPower, 150},
+			{"uphillPower", &q.UphillPower, 280},
+			{"downhillPower", &q.DownhillPower, 40},
+			{"tailWindPower", &q.TailWindPower, 90},
+			{"headWindPower", &q.HeadWindPower, 120},
+			{"CUT", &q.CUT, 1.3},
+			{"CUH", &q.CUH, 0.8},
+		}
+	)
+	for _, w := range want {
+		*w.value = w.x
+	}
+	if err := setupPowerModel(gen, p); err != nil {
+		t.Fatal(err)
+	}
+	for grade := -0.03; grade < 0.0501; grade += 0.01 {
+		for wind := -4.0; wind <= 4; wind++ {
+			pow := q.FlatPower * gen.Ratio(grade, wind)
+			obs = append(obs, fitObs{grade: grade, wind: wind, power: pow, time: 10})
+		}
+	}
+	for _, w := range want {
+		*w.value = w.x * 1.1 // fit from off values
+	}
+	res, err := fitPowerModel(obs, motion.Calculator(), gen, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := res.Statistics; !st.Converged || !slices.Equal(st.NotFitted, []string{"CDT", "CDH"}) {
+		t.Fatalf("converged %v, not fitted %v", st.Converged, st.NotFitted)
+	}
+	for _, w := range want {
+		if math.Abs(*w.value/w.x-1) > 1e-4 {
+			t.Errorf("%s = %g, want %g", w.name, *w.value, w.x)
+		}
+	}
+}
+
+// TestSegmentObs checks the segment times and powers of a recorded climb at
+// a constant power with a pause.
+func TestSegmentObs(t *testing.T) {
+	const (
+		pow   = 200.0 // W
+		step  = 5.0   // m per second
+		pause = 120.0 // s
+	)
+	var (
+		p    = fitParameters(t)
+		recs []gpx.Record
+		time float64
+	)
+	for i := range 400 {
+		if i == 200 {
+			time += pause // not ridden
+		}
+		recs = append(recs, gpx.Record{
+			Lat:   60 + float64(i)*step/degreeDist,
+			Lon:   25,
+			Ele:   10 + 0.02*float64(i)*step,
+			Time:  time,
+			Power: pow,
+		})
+		time++
+	}
+	rou, err := route.New(recordsGPX(recs), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rou.SetupRoad(p)
+	rou.Filter()
+	var sumT float64
+	for _, o := range segmentObs(rou, recs, 1) {
+		if math.Abs(o.power-pow) > 1e-9 {
+			t.Errorf("segment power %g, want %g", o.power, pow)
+		}
+		sumT += o.time
+	}
+	// 398 ridden 1 s intervals, segments under minFitSegTime left out
+	if want := float64(len(recs) - 2); sumT > want || sumT < want-20 {
+		t.Errorf("riding time %g, want %g", sumT, want)
+	}
+}
@@ -0,0 +1,205 @@
+package gpx
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+/*
+ParseFIT parses the record messages of FIT activity file data. Only the
+fields for the ride samples are decoded:
+
+	253 timestamp          uint32, s since 1989-12-31 00:00 UTC
+	0   position_lat       sint32, semicircles
+	1   position_long      sint32, semicircles
+	2   altitude           uint16, 5 x m + 500
+	78  enhanced_altitude  uint32, 5 x m + 500
+	7   power              uint16, W
+	6   speed              uint16, 1000 x m/s
+	73  enhanced_speed     uint32, 1000 x m/s
+
+Compressed timestamp headers are supported. Developer data fields are
+skipped. The file CRC is not checked.
+*/
+
+const (
+	fitRecordMsg   = 20
+	fitTimestamp   = 253
+	fitLat         = 0
+	fitLon         = 1
+	fitAltitude    = 2
+	fitEnhancedAlt = 78
+	fitPower       = 7
+	fitSpeed       = 6
+	fitEnhancedVel = 73
+	fitUnixOffset  = 631065600 // FIT epoch 1989-12-31 as Unix time
+	semicircle2deg = 180.0 / (1 << 31)
+)
+
+type fitField struct {
+	num  byte
+	size int
+}
+
+type fitDefinition struct {
+	global  uint16
+	order   binary.ByteOrder
+	fields  []fitField
+	devSize int
+}
+
+// ParseFIT returns the ride samples of FIT file data. Times are Unix times (s).
+func ParseFIT(data []byte) ([]Record, error) {
+	if len(data) < 12 || string(data[8:12]) != ".FIT" {
+		return nil, errf("not a FIT file")
+	}
+	headerSize := int(data[0])
+	end := headerSize + int(binary.LittleEndian.Uint32(data[4:8]))
+	if headerSize < 12 || end > len(data) {
+		return nil, errf("invalid FIT header")
+	}
+	var (
+		defs      [16]*fitDefinition
+		recs      []Record
+		timestamp uint32
+		b         = data[headerSize:end]
+	)
+	for len(b) > 0 {
+		h := b[0]
+		b = b[1:]
+		local := h & 0x0f
+		compressed := h&0x80 != 0
+		if compressed {
+			local = (h >> 5) & 0x03
+			offset := uint32(h & 0x1f)
+			t := timestamp&^0x1f + offset
+			if offset < timestamp&0x1f {
+				t += 0x20
+			}
+			timestamp = t
+		} else if h&0x40 != 0 {
+			d, n, err := parseFitDefinition(b, h&0x20 != 0)
+			if err != nil {
+				return nil, err
+			}
+			defs[local] = d
+			b = b[n:]
+			continue
+		}
+		d := defs[local]
+		if d == nil {
+			return nil, errf("FIT data message without definition")
+		}
+		r, n, ok := d.parseRecord(b, timestamp, compressed)
+		if n > len(b) {
+			return nil, errf("truncated FIT data")
+		}
+		b = b[n:]
+		if !compressed {
+			timestamp = uint32(r.Time)
+		}
+		if d.global != fitRecordMsg {
+			continue
+		}
+		if ok {
+			r.Time += fitUnixOffset
+			recs = append(recs, r)
+		}
+	}
+	return recs, nil
+}
+
+// parseFitDefinition returns the definition message in b and its length.
+func parseFitDefinition(b []byte, devData bool) (*fitDefinition, int, error) {
+	if len(b) < 5 {
+		return nil, 0, errf("truncated FIT definition")
+	}
+	d := &fitDefinition{order: binary.LittleEndian}
+	if b[1] == 1 {
+		d.order = binary.BigEndian
+	}
+	d.global = d.order.Uint16(b[2:4])
+	nFields := int(b[4])
+	n := 5 + 3*nFields
+	if len(b) < n {
+		return nil, 0, errf("truncated FIT definition")
+	}
+	for i := 0; i < nFields; i++ {
+		f := b[5+3*i:]
+		d.fields = append(d.fields, fitField{num: f[0], size: int(f[1])})
+	}
+	if devData {
+		if len(b) < n+1 {
+			return nil, 0, errf("truncated FIT definition")
+		}
+		nDev := int(b[n])
+		n++
+		if len(b) < n+3*nDev {
+			return nil, 0, errf("truncated FIT definition")
+		}
+		for i := 0; i < nDev; i++ {
+			d.devSize += int(b[n+3*i+1])
+		}
+		n += 3 * nDev
+	}
+	return d, n, nil
+}
+
+// parseRecord returns the record message fields in b, the message length
+// and whether the record has a time and a position. Time is FIT time and
+// the timestamp of all messages is decoded for the compressed timestamps.
+func (d *fitDefinition) parseRecord(b []byte, timestamp uint32, compressed bool) (Record, int, bool) {
+	var (
+		r        = Record{Time: float64(timestamp), Power: -1, Speed: -1}
+		n        int
+		lat, lon bool
+		hasTime  = compressed
+	)
+	for _, f := range d.fields {
+		if n+f.size > len(b) {
+			return r, n + f.size, false
+		}
+		v := b[n : n+f.size]
+		n += f.size
+		if f.num == fitTimestamp && f.size == 4 {
+			if x := d.order.Uint32(v); x != math.MaxUint32 {
+				r.Time, hasTime = float64(x), true
+			}
+			continue
+		}
+		if d.global != fitRecordMsg {
+			continue
+		}
+		switch {
+		case f.num == fitLat && f.size == 4:
+			if x := int32(d.order.Uint32(v)); x != math.MaxInt32 {
+				r.Lat, lat = float64(x)*semicircle2deg, true
+			}
+		case f.num == fitLon && f.size == 4:
+			if x := int32(d.order.Uint32(v)); x != math.MaxInt32 {
+				r.Lon, lon = float64(x)*semicircle2deg, true
+			}
+		case f.num == fitAltitude && f.size == 2:
+			if x := d.order.Uint16(v); x != math.MaxUint16 {
+				r.Ele = float64(x)/5 - 500
+			}
+		case f.num == fitEnhancedAlt && f.size == 4:
+			if x := d.order.Uint32(v); x != math.MaxUint32 {
+				r.Ele = float64(x)/5 - 500
+			}
+		case f.num == fitPower && f.size == 2:
+			if x := d.order.Uint16(v); x != math.MaxUint16 {
+				r.Power = float64(x)
+			}
+		case f.num == fitSpeed && f.size == 2:
+			if x := d.order.Uint16(v); x != math.MaxUint16 {
+				r.Speed = float64(x) / 1000
+			}
+		case f.num == fitEnhancedVel && f.size == 4:
+			if x := d.order.Uint32(v); x != math.MaxUint32 {
+				r.Speed = float64(x) / 1000
+			}
+		}
+	}
+	return r, n + d.devSize, hasTime && lat && lon
+}
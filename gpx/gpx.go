@@ -15,6 +15,7 @@ type GPX struct {
 	Version string `xml:"version,attr"`
 	Time    string `xml:"time"`
 	Trks    []Trk  `xml:"trk"`
+	Wpts    []Wpt  `xml:"wpt"`
 	errcnt  int
 }
 type Trk struct {
@@ -29,6 +30,11 @@ type Trkpt struct {
 	Lon float64 `xml:"lon,attr"`
 	Ele float64 `xml:"ele"`
 }
+type Wpt struct {
+	Lat  float64 `xml:"lat,attr"`
+	Lon  float64 `xml:"lon,attr"`
+	Name string  `xml:"name"`
+}
 
 const (
 	quotemark     = '"'   // '\'' (single quote) is also accepted by XML parser
@@ -38,12 +44,10 @@ const (
 var (
 	// latname     = []byte("lat")
 	// lonname     = []byte("lon")
-	eletag      = []byte("<ele>")
-	opentag     = []byte("<trkpt")
-	closetag    = []byte("</trkpt>")
-	trkpLen     int //estimate lenght of a track point slice in bytes
-	startSearch int //index from where to start searching for </trkpt>
-	errf        = fmt.Errorf
+	eletag   = []byte("<ele>")
+	opentag  = []byte("<trkpt")
+	closetag = []byte("</trkpt>")
+	errf     = fmt.Errorf
 )
 
 // func ReadGPXfile(gpxFile string) ([]byte, error) {
@@ -80,18 +84,18 @@ ParseGPX is 25 x faster than encoding/xml.Unmarshal
 */
 func ParseGPX(gpxbytes []byte, gpx *GPX, ignoreErrors bool) error {
 	var trkpSlice []byte
-	var points int
+	var points, trkpLen int
 
+	gpx.Wpts = parseWaypoints(gpxbytes)
 	gpxbytes, e := selectTrkSegment(gpxbytes)
 	if e != nil {
 		return e
 	}
 	points, trkpLen = trkpCountEstimate(gpxbytes)
-	startSearch = trkpLen - (len(closetag) + 2)
 	trkseg := makeTrkseg(points, gpx)
 	trkpnum := 0
 	for {
-		trkpSlice, gpxbytes = nextTrkpt(gpxbytes)
+		trkpSlice, gpxbytes = nextTrkpt(gpxbytes, &trkpLen)
 		if trkpSlice == nil {
 			break
 		}
@@ -127,7 +131,8 @@ func selectTrkSegment(b []byte) ([]byte, error) {
 /*
 nextTrkpt returns the first trackpoint slice of the slice gpxbytes.
 nextTrkpt also returnsa a modified gpxbytes, which is the tail of gpxbytes,
-when the first track point is removed from it.
+when the first track point is removed from it. trkpLen is the estimated
+length of a track point slice in bytes and it is adjusted on missed tags.
 Searched track point can be e.g.
 <trkpt lon="-5.760211" lat="37.942557"> <ele>615.25</ele> </trkpt>
 Returned slice is e.g.
@@ -138,22 +143,22 @@ disturbing parsing of lat, lon and ele values. Trackpoint closing
 tags are not checked or used any way. Trackpoint slice is identified as something
 between two opening tags <trkpt.
 */
-func nextTrkpt(gpxbytes []byte) (trkpSlice, gpxbytesTail []byte) {
+func nextTrkpt(gpxbytes []byte, trkpLen *int) (trkpSlice, gpxbytesTail []byte) {
 	const jmptoattrib = 7
 
 	b := gpxbytes
-	if len(b) < trkpLen/2 {
+	if len(b) < *trkpLen/2 {
 		return nil, b
 	}
-	r := trkpLen
+	r := *trkpLen
 	d := indexTag(b[r:], []byte("<trkpt"))
 	r += d
 	if d < 0 { //last trkp, no opening tags anymore
 		return b[jmptoattrib:], b[0:0]
 	}
-	if d > trkpLen/2 { //missed opening tag, retry, rare case
-		trkpLen--
-		r = trkpLen / 2
+	if d > *trkpLen/2 { //missed opening tag, retry, rare case
+		*trkpLen--
+		r = *trkpLen / 2
 		d = indexTag(b[r:], []byte("<trkpt"))
 		r += d
 	}
@@ -188,6 +193,61 @@ func parseTrkpt(b []byte) (Trkpt, error) {
 	return point, e1
 }
 
+/*
+parseWaypoints parses lat, lon and name values of all waypoints from GPX
+file data. Waypoints are e.g.
+
+	<wpt lat="37.942557" lon="-5.760211"><name>Cazalla</name></wpt>
+
+Waypoints with missing or bad coordinates are skipped. Waypoints are few,
+so the standard bytes.Index is used.
+*/
+func parseWaypoints(b []byte) []Wpt {
+	var wpts []Wpt
+	for {
+		l := bytes.Index(b, []byte("<wpt"))
+		if l < 0 {
+			return wpts
+		}
+		b = b[l+len("<wpt"):]
+		k := indexByte(b, '>')
+		if k < 1 {
+			return wpts
+		}
+		attr, body := b[:k], b[k:k]
+		if b[k-1] != '/' {
+			r := bytes.Index(b, []byte("</wpt>"))
+			if r < k {
+				return wpts
+			}
+			body = b[k:r]
+		}
+		lat, e1 := parseCoordinate(attr, []byte("lat"))
+		lon, e2 := parseCoordinate(attr, []byte("lon"))
+		if e1 != nil || e2 != nil {
+			continue
+		}
+		wpts = append(wpts, Wpt{Lat: lat, Lon: lon, Name: parseName(body)})
+	}
+}
+
+// parseName returns the text of the <name> tag in b, or "".
+func parseName(b []byte) string {
+	l := bytes.Index(b, []byte("<name>"))
+	if l < 0 {
+		return ""
+	}
+	b = b[l+len("<name>"):]
+	r := bytes.Index(b, []byte("</name>"))
+	if r < 0 {
+		return ""
+	}
+	b = bytes.TrimSpace(b[:r])
+	b = bytes.TrimPrefix(b, []byte("<![CDATA["))
+	b = bytes.TrimSuffix(b, []byte("]]>"))
+	return string(b)
+}
+
 // parseElevatione returns elevation value from the trackpoint slice b.
 func parseElevation(b []byte) (float64, error) {
 	const eleKeyLen = 5
@@ -246,6 +306,16 @@ func (gpx *GPX) TrkpSliceRelease() {
 	gpx.Trks[0].Trksegs[0].Trkpts = nil
 }
 
+// Append appends the track points and the waypoints of g to gpx. The
+// track points of g follow the last track point of gpx in the first
+// track segment.
+func (gpx *GPX) Append(g *GPX) {
+	trkseg := &gpx.Trks[0].Trksegs[0].Trkpts
+	*trkseg = append(*trkseg, g.TrkpSlice()...)
+	gpx.Wpts = append(gpx.Wpts, g.Wpts...)
+	gpx.errcnt += g.errcnt
+}
+
 // clipTrkseg clips excess capacity from the single gpx track segment []Trkpt.
 func clipTrkseg(gpx *GPX) {
 	s := gpx.Trks[0].Trksegs[0].Trkpts
@@ -2,7 +2,9 @@ package gpx
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/xml"
+	"math"
 	"os"
 	"testing"
 )
@@ -10,6 +12,7 @@ import (
 var Isink int
 var Bsink bool
 var E error
+var trkpLen int
 var trkpSlice = []byte("<trkpt lat=\"37.942557\" lon=\"-5.760211\"><ele>615.25</ele></trkpt>")
 
 func initData() []byte {
@@ -17,7 +20,6 @@ func initData() []byte {
 	gpxbytes, _ := os.ReadFile(gpxFileName)
 	_, l := trkpCountEstimate(gpxbytes)
 	trkpLen = l
-	startSearch = trkpLen - (len(closetag) + 2)
 	d := bytes.Index(gpxbytes, opentag)
 	gpxbytes = gpxbytes[d:]
 	return gpxbytes
@@ -119,7 +121,7 @@ func Benchmark_NextTrkpt(b *testing.B) {
 	for range b.N {
 		g := s
 		for {
-			q, g = nextTrkpt(g)
+			q, g = nextTrkpt(g, &trkpLen)
 			if q == nil {
 				break
 			}
@@ -140,7 +142,7 @@ func BenchmarkParseAll(b *testing.B) {
 	for range b.N {
 		g := s
 		for {
-			q, g = nextTrkpt(g)
+			q, g = nextTrkpt(g, &trkpLen)
 			if q == nil {
 				break
 			}
@@ -148,3 +150,116 @@ func BenchmarkParseAll(b *testing.B) {
 		}
 	}
 }
+
+func TestParseWaypoints(t *testing.T) {
+	data := []byte(`<gpx><wpt lat="37.9" lon="-5.7"><ele>600</ele><name> Cazalla </name></wpt>
+<wpt lon="-5.8" lat="38.0"/><wpt lat="x" lon="1"></wpt>
+<trk><trkseg><trkpt lat="37.942557" lon="-5.760211"><ele>615.25</ele></trkpt></trkseg></trk></gpx>`)
+	gpx := &GPX{}
+	if err := ParseGPX(data, gpx, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(gpx.Wpts) != 2 {
+		t.Fatalf("waypoints %d, want 2", len(gpx.Wpts))
+	}
+	if w := gpx.Wpts[0]; w.Lat != 37.9 || w.Lon != -5.7 || w.Name != "Cazalla" {
+		t.Errorf("first waypoint %+v", w)
+	}
+	if w := gpx.Wpts[1]; w.Lat != 38.0 || w.Lon != -5.8 || w.Name != "" {
+		t.Errorf("second waypoint %+v", w)
+	}
+}
+
+func TestAppend(t *testing.T) {
+	a := []byte(`<gpx><wpt lat="37.9" lon="-5.7"><name>A</name></wpt><trk><trkseg>
+<trkpt lat="37.90" lon="-5.70"><ele>600</ele></trkpt>
+<trkpt lat="37.91" lon="-5.70"><ele>610</ele></trkpt></trkseg></trk></gpx>`)
+	b := []byte(`<gpx><wpt lat="37.95" lon="-5.7"><name>B</name></wpt><trk><trkseg>
+<trkpt lat="37.95" lon="-5.70"><ele>650</ele></trkpt></trkseg></trk></gpx>`)
+	ga, gb := &GPX{}, &GPX{}
+	if err := ParseGPX(a, ga, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := ParseGPX(b, gb, false); err != nil {
+		t.Fatal(err)
+	}
+	ga.Append(gb)
+	tps := ga.TrkpSlice()
+	if len(tps) != 3 || tps[2].Lat != 37.95 || tps[2].Ele != 650 {
+		t.Errorf("track points %+v", tps)
+	}
+	if len(ga.Wpts) != 2 || ga.Wpts[1].Name != "B" {
+		t.Errorf("waypoints %+v", ga.Wpts)
+	}
+}
+
+func TestParseRecords(t *testing.T) {
+	data := []byte(`<gpx><trk><trkseg>
+<trkpt lat="37.90" lon="-5.70"><ele>600</ele><time>2024-05-18T08:30:00Z</time>
+<extensions><gpxtpx:TrackPointExtension><gpxtpx:power>180</gpxtpx:power><gpxtpx:speed>6.5</gpxtpx:speed></gpxtpx:TrackPointExtension></extensions></trkpt>
+<trkpt lat="37.91" lon="-5.70"><ele>610</ele><time>2024-05-18T08:30:05Z</time><extensions><power>210</power></extensions></trkpt>
+<trkpt lat="37.92" lon="-5.70"><ele>620</ele></trkpt>
+<trkpt lat="37.93" lon="-5.70"><ele>630</ele><time>2024-05-18T08:30:10Z</time></trkpt></trkseg></trk></gpx>`)
+	recs, err := ParseRecords(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 3 {
+		t.Fatalf("records %d, want 3", len(recs))
+	}
+	if r := recs[0]; r.Power != 180 || r.Speed != 6.5 || r.Ele != 600 || r.Time != 1716021000 {
+		t.Errorf("first record %+v", r)
+	}
+	if r := recs[1]; r.Power != 210 || r.Speed != -1 || r.Time-recs[0].Time != 5 {
+		t.Errorf("second record %+v", r)
+	}
+	if r := recs[2]; r.Power != -1 || r.Lat != 37.93 {
+		t.Errorf("third record %+v", r)
+	}
+}
+
+func TestParseFIT(t *testing.T) {
+	le := binary.LittleEndian
+	var b []byte
+	// definition of local message 0: record, timestamp, lat, long, enhanced_altitude, power, speed
+	b = append(b, 0x40, 0, 0)
+	b = le.AppendUint16(b, fitRecordMsg)
+	b = append(b, 6, fitTimestamp, 4, 0x86, fitLat, 4, 0x85, fitLon, 4, 0x85,
+		fitEnhancedAlt, 4, 0x86, fitPower, 2, 0x84, fitSpeed, 2, 0x84)
+	record := func(h byte, time uint32, lat, lon int32, alt uint32, power uint16) {
+		b = append(b, h)
+		b = le.AppendUint32(b, time)
+		b = le.AppendUint32(b, uint32(lat))
+		b = le.AppendUint32(b, uint32(lon))
+		b = le.AppendUint32(b, alt)
+		b = le.AppendUint16(b, power)
+		b = le.AppendUint16(b, 8250)
+	}
+	record(0, 1000, 1<<29, -1<<28, 5*(600+500), 200)
+	record(0, 1005, 1<<29, math.MaxInt32, 5*(600+500), 200) // no longitude
+	// definition of local message 1: record, lat, long, power, compressed timestamps
+	b = append(b, 0x41, 0, 0)
+	b = le.AppendUint16(b, fitRecordMsg)
+	b = append(b, 3, fitLat, 4, 0x85, fitLon, 4, 0x85, fitPower, 2, 0x84)
+	b = append(b, 0x80|1<<5|(1010&0x1f))
+	b = le.AppendUint32(b, 1<<29)
+	b = le.AppendUint32(b, 1<<28)
+	b = le.AppendUint16(b, math.MaxUint16)
+
+	header := []byte{12, 0x10, 0, 0, 0, 0, 0, 0, '.', 'F', 'I', 'T'}
+	le.PutUint32(header[4:8], uint32(len(b)))
+	recs, err := ParseFIT(append(header, b...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("records %d, want 2", len(recs))
+	}
+	if r := recs[0]; r.Lat != 45 || r.Lon != -22.5 || r.Ele != 600 || r.Power != 200 || r.Speed != 8.25 ||
+		r.Time != 1000+fitUnixOffset {
+		t.Errorf("first record %+v", r)
+	}
+	if r := recs[1]; r.Lon != 22.5 || r.Power != -1 || r.Speed != -1 || r.Time != 1010+fitUnixOffset {
+		t.Errorf("compressed timestamp record %+v", r)
+	}
+}
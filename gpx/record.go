@@ -0,0 +1,130 @@
+package gpx
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Record is a recorded ride sample. Time is in seconds from the first
+// sample. Power (W) and Speed (m/s) are -1 if not recorded.
+type Record struct {
+	Lat   float64
+	Lon   float64
+	Ele   float64
+	Time  float64
+	Power float64
+	Speed float64
+}
+
+// ReadRecords reads the recorded ride samples of a GPX or FIT file. Files
+// with extension .fit are read as FIT files. GPX track points need a <time>
+// tag and the power is read from a <power> tag in the track point
+// extensions, e.g. <gpxtpx:power>, and the speed from a <speed> tag.
+// Samples without a time or a position are skipped.
+func ReadRecords(file string) ([]Record, error) {
+	data, e := os.ReadFile(file)
+	if e != nil {
+		return nil, errf("%v", e)
+	}
+	var recs []Record
+	if strings.HasSuffix(strings.ToLower(file), ".fit") {
+		recs, e = ParseFIT(data)
+	} else {
+		recs, e = ParseRecords(data)
+	}
+	if e != nil {
+		return nil, errf("%s: %v", file, e)
+	}
+	if len(recs) < 2 {
+		return nil, errf("%s: no recorded samples with time and position", file)
+	}
+	t0 := recs[0].Time
+	for i := range recs {
+		recs[i].Time -= t0
+	}
+	return recs, nil
+}
+
+// ParseRecords parses the recorded ride samples of GPX file data. Times are
+// Unix times (s).
+func ParseRecords(gpxbytes []byte) ([]Record, error) {
+	var (
+		trkpSlice []byte
+		recs      []Record
+		trkpLen   int
+	)
+	gpxbytes, e := selectTrkSegment(gpxbytes)
+	if e != nil {
+		return nil, e
+	}
+	_, trkpLen = trkpCountEstimate(gpxbytes)
+	for {
+		trkpSlice, gpxbytes = nextTrkpt(gpxbytes, &trkpLen)
+		if trkpSlice == nil {
+			return recs, nil
+		}
+		trkp, err := parseTrkpt(trkpSlice)
+		if err != nil {
+			continue
+		}
+		t, ok := parseTime(trkpSlice)
+		if !ok {
+			continue
+		}
+		recs = append(recs, Record{
+			Lat:   trkp.Lat,
+			Lon:   trkp.Lon,
+			Ele:   trkp.Ele,
+			Time:  t,
+			Power: parseExtension(trkpSlice, []byte("power>")),
+			Speed: parseExtension(trkpSlice, []byte("speed>")),
+		})
+	}
+}
+
+// parseTime returns the <time> of the track point slice b as Unix time (s).
+func parseTime(b []byte) (float64, bool) {
+	s := tagText(b, []byte("<time>"))
+	if s == nil {
+		return 0, false
+	}
+	t, e := time.Parse(time.RFC3339, string(bytes.TrimSpace(s)))
+	if e != nil {
+		return 0, false
+	}
+	return float64(t.UnixNano()) * 1e-9, true
+}
+
+// parseExtension returns the value of the extension tag name, e.g. power>,
+// of the track point slice b, or -1. The tag may have a namespace prefix,
+// e.g. <gpxtpx:power>.
+func parseExtension(b, name []byte) float64 {
+	l := bytes.Index(b, name)
+	if l < 1 || (b[l-1] != '<' && b[l-1] != ':') {
+		return -1
+	}
+	s := tagText(b[l-1:], b[l-1:l+len(name)])
+	x, e := strconv.ParseFloat(string(bytes.TrimSpace(s)), 64)
+	if e != nil {
+		return -1
+	}
+	return x
+}
+
+// tagText returns the text after the first instance of tag in b
+// until the next '<', or nil.
+func tagText(b, tag []byte) []byte {
+	l := bytes.Index(b, tag)
+	if l < 0 {
+		return nil
+	}
+	b = b[l+len(tag):]
+	r := indexByte(b, '<')
+	if r < 0 {
+		return nil
+	}
+	return b[:r]
+}
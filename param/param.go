@@ -1,5 +1,7 @@
 package param
 
+import "time"
+
 const (
 	kmh2ms  = 1.0 / 3.6
 	ms2kmh  = 3.6
@@ -22,6 +24,14 @@ type Parameters struct {
 	Powermodel  powermodel
 	Ride        ride
 	Bike        bike
+	Group       group `json:"groupRide"`
+	Fatigue     fatigue
+	Nutrition   nutrition
+	RestStops   restStops `json:"restStops"`
+	Gearing     gearing
+	Walking     walking
+	Ebike       ebike `json:"eBike"`
+	Histograms  histograms
 
 	calculation
 	filesEtc
@@ -85,6 +95,8 @@ type filesEtc struct {
 	LogMode         int    `json:"logMode"`
 	LogLevel        int    `json:"logLevel"`
 	CheckParams     bool   `json:"checkParams"`
+
+	AppendGPX []string `json:"appendGPXfiles"` // appended to GPXfile in order
 }
 
 type ride struct {
@@ -106,6 +118,119 @@ type ride struct {
 	KeepEntrySpeed float64 `json:"keepEntrySpeed (%)"`
 	ReverseRoute   bool    `json:"reverseRoute"`
 	RoundTrip      bool    `json:"roundTrip"`
+
+	// Route composition before the track point import in the order cut,
+	// turn around and laps. Not used if < 0, "" or laps <= 1.
+	CutFrom         float64 `json:"cutFrom (km)"`
+	CutTo           float64 `json:"cutTo (km)"`
+	CutFromWaypoint string  `json:"cutFromWaypoint"`
+	CutToWaypoint   string  `json:"cutToWaypoint"`
+	TurnAround      float64 `json:"turnAround (km)"`
+	Laps            int     `json:"laps"`
+
+	StartTime string    `json:"startTime"`     // e.g. "2024-05-18 08:30"
+	Start     time.Time `json:"-"`             // parsed from StartTime
+	UTCOffset float64   `json:"utcOffset (h)"` // local time - UTC
+}
+
+// Group ride rotation: pulls at the front by time or by distance.
+type group struct {
+	Size         int     `json:"groupSize"`
+	PullFraction float64 `json:"pullFraction (%)"` // default 100 / groupSize
+	PullTime     float64 `json:"pullTime (min)"`
+	PullDist     float64 `json:"pullDistance (km)"`
+	DraftCdA     float64 `json:"draftCdA (%)"` // sheltered CdA of the front CdA
+}
+
+// Fatigue by critical power and W' balance. Not used if criticalPower <= 0.
+type fatigue struct {
+	CP             float64 `json:"criticalPower (w)"`
+	WPrime         float64 `json:"wPrime (kJ)"`
+	CapBalance     float64 `json:"capBalance (%)"`       // power capped to CP below this W' balance
+	EnduranceDecay float64 `json:"enduranceDecay (%/h)"` // power and CP decrease per ride hour
+}
+
+// Nutrition plan: carbohydrates, fluid and feeds every feedInterval of
+// ride time. No feeds if feedInterval <= 0.
+type nutrition struct {
+	CarbsPerHour float64 `json:"carbsPerHour (g/h)"`
+	FeedInterval float64 `json:"feedInterval (min)"`
+	SweatRate    float64 `json:"sweatRate (l/h)"` // -1: by temperature and rider power
+	WaypointSnap float64 `json:"waypointSnap (km)"`
+	CarriedFood  float64 `json:"carriedFood (kg)"`  // added to the total weight
+	CarriedWater float64 `json:"carriedWater (kg)"` // added to the total weight
+	Foods        []food  `json:"foods"`             // energy equivalent foods of the rider energy
+}
+
+type food struct {
+	Name   string  `json:"name"`
+	Unit   string  `json:"unit"`
+	Energy float64 `json:"energy (kJ)"` // per unit
+}
+
+// Rest stops every everyTime or everyDistance from the previous stop and
+// meal stops at clock times. A stop is moved to the nearest waypoint within
+// waypointSnap. No stops if everyTime, everyDistance and meals are not given.
+type restStops struct {
+	EveryTime    float64 `json:"everyTime (h)"`
+	EveryDist    float64 `json:"everyDistance (km)"`
+	Duration     float64 `json:"duration (min)"`
+	WaypointSnap float64 `json:"waypointSnap (km)"`
+	Meals        []meal  `json:"meals"`
+}
+
+// Drivetrain gearing and cadence range. Not used without chainrings and
+// cassette. The top gear at maxCadence gives maxPedaledSpeed.
+type gearing struct {
+	Chainrings         []float64 `json:"chainrings (teeth)"`
+	Cassette           []float64 `json:"cassette (teeth)"`
+	WheelCircumference float64   `json:"wheelCircumference (mm)"`
+	MinCadence         float64   `json:"minCadence (rpm)"`
+	MaxCadence         float64   `json:"maxCadence (rpm)"`
+}
+
+// Hike-a-bike: the rider walks the uphill segments steeper than walkGrade
+// or where riding at minSpeed needs more than walkPowerLimit of uphillPower.
+// Not used if both are <= 0. The walking speed is Tobler's hiking function
+// with the max speed walkMaxSpeed at -5 % grade.
+type walking struct {
+	Grade      float64 `json:"walkGrade (%)"`
+	PowerLimit float64 `json:"walkPowerLimit (%)"`
+	MaxSpeed   float64 `json:"walkMaxSpeed (km/h)"`
+	Cost       float64 `json:"walkCost (J/kg/m)"` // level walking as rider work
+}
+
+// E-bike motor assist: the motor adds assist of the rider power, at most
+// maxMotorPower, below assistCutoffSpeed. No motor if assist <= 0.
+// Regenerative braking recovers regenBraking of the braking energy at most
+// by maxRegenPower. With regenDescentSpeed the descents are held at the
+// speed by regeneration.
+type ebike struct {
+	Assist      float64 `json:"assist (%)"`
+	MaxPower    float64 `json:"maxMotorPower (w)"`
+	CutoffSpeed float64 `json:"assistCutoffSpeed (km/h)"` // 25, S-pedelec 45
+	Efficiency  float64 `json:"motorEfficiency (%)"`
+	Battery     float64 `json:"batteryCapacity (Wh)"`
+
+	Regen         float64 `json:"regenBraking (%)"`
+	MaxRegenPower float64 `json:"maxRegenPower (w)"`
+	RegenSpeed    float64 `json:"regenDescentSpeed (km/h)"`
+}
+
+// Histograms of time, distance and rider energy by power zone, speed band
+// and grade band. The limits are the lower limits of the bins from the
+// second bin. No power zones if FTP <= 0 and no bands if not given.
+type histograms struct {
+	FTP        float64   `json:"FTP (w)"`
+	PowerZones []float64 `json:"powerZones (%FTP)"`
+	SpeedBands []float64 `json:"speedBands (km/h)"`
+	GradeBands []float64 `json:"gradeBands (%)"`
+}
+
+type meal struct {
+	At       string  `json:"at"` // clock time, e.g. "12:30"
+	Duration float64 `json:"duration (min)"`
+	Clock    float64 `json:"-"` // s from midnight, parsed from At
 }
 
 type uphillBreak struct {
@@ -115,7 +240,10 @@ type uphillBreak struct {
 }
 
 type powermodel struct {
-	PowermodelType int `json:"powerModel"`
+	PowermodelType int    `json:"powerModel"`
+	RatioTableFile string `json:"ratioTableFile"` // power ratio table of powerModel 5
+
+	SpeedSchedule speedSchedule `json:"speedSchedule"` // target speeds of powerModel 6
 
 	FlatSpeed float64 `json:"flatGroundSpeed (km/h)"`
 	FlatPower float64 `json:"flatGroundPower (w)"`
@@ -131,6 +259,11 @@ type powermodel struct {
 	MaxPedaledSpeed    float64 `json:"maxPedaledSpeed (km/h)"`
 	MinPedaledGrade    float64 // calculated from maxPedaledSpeed
 
+	// 0: none, 1: linear, 2: acclimatised, 3: non-acclimatised
+	AltitudeModel  int     `json:"altitudeModel"`
+	AltitudeLoss   float64 `json:"altitudePowerLoss (%/1000 m)"`
+	AcclimAltitude float64 `json:"acclimatisationAltitude (m)"`
+
 	SysTailwind           float64 `json:"sysTailwind (m/s)"`
 	SysHeadwind           float64 `json:"sysHeadwind (m/s)"`
 	TailWindPower         float64 `json:"tailWindPower (%)"`
@@ -147,6 +280,15 @@ type powermodel struct {
 	CUH                   float64
 }
 
+// speedSchedule is the target speed table of the speed schedule pacing
+// model. Speed has a row for each grade and a value for each wind. Without
+// winds the rows have a single speed for all winds.
+type speedSchedule struct {
+	Grade []float64   `json:"grade (%)"`
+	Wind  []float64   `json:"wind (m/s)"`
+	Speed [][]float64 `json:"speed (km/h)"`
+}
+
 type weight struct {
 	Rider    float64 `json:"rider"`
 	Bike     float64 `json:"bike"`
@@ -164,6 +306,10 @@ type bike struct {
 	Cbf            float64 `json:"brakeFriction"`
 	Ccf            float64 `json:"turnFriction"`
 	Weight         weight  `json:"weight (kg)"`
+
+	// CdA ratios to the zero yaw CdA by the apparent wind yaw angle,
+	// e.g. [[0, 1], [10, 1.04], [20, 1.12]]. Empty: no crosswind drag.
+	YawCdA [][2]float64 `json:"yawCdA [deg ratio]"`
 }
 
 type environment struct {
@@ -174,4 +320,27 @@ type environment struct {
 	AirDensity    float64 `json:"airDensity rho"`
 	AirPressure   float64 `json:"airPressure (hPa)"`
 	Gravity       float64 `json:"gravity (m/s^2)"`
+	WindForecast  string  `json:"windForecastFile"`
+	WindField     string  `json:"windFieldFile"`
+
+	// Wind profile from the measurement height to the rider height.
+	// Terrain is open, suburban or forest, "" for no wind profile.
+	WindHeight      float64          `json:"windHeight (m)"`
+	Terrain         string           `json:"terrain"`
+	TerrainSections []terrainSection `json:"terrainSections"`
+
+	// Air density by segment elevation and arrival time temperature.
+	SegmentRho          bool    `json:"airDensityBySegment"`
+	TemperatureDayRange float64 `json:"temperatureDayRange (C)"`
+
+	// Base elevation humidity, one of these or none for dry air.
+	RelativeHumidity float64 `json:"relativeHumidity (%)"`
+	DewPoint         float64 `json:"dewPoint (C)"`
+	MoistAir         float64 `json:"-"` // moist / dry air density, calculated
+}
+
+type terrainSection struct {
+	From    float64 `json:"from (km)"`
+	To      float64 `json:"to (km)"`
+	Terrain string  `json:"terrain"`
 }
@@ -4,6 +4,10 @@ import (
 	"encoding/json"
 	"io"
 	"os"
+	"sort"
+	"time"
+
+	"github.com/pekkizen/bikeride/weather"
 )
 
 func New(args []string, l logger) (*Parameters, error) {
@@ -82,6 +86,7 @@ func (p *Parameters) setSystemDefaultValues() {
 
 	// r := &p.Ride
 	q := &p.Powermodel
+	e := &p.Environment
 	f := &p.Filter
 	u := &p.UphillBreak
 
@@ -132,6 +137,9 @@ func (p *Parameters) setSystemDefaultValues() {
 	q.DownhillTailwindPower = 5
 	q.DownhillHeadwindPower = 100
 	q.VerticalUpGrade = 8
+	q.AltitudeModel = 0
+	q.AltitudeLoss = 7
+	q.AcclimAltitude = 0
 	q.CUT = 1
 	q.CUH = 1
 	q.CDT = 1
@@ -150,6 +158,76 @@ func (p *Parameters) setSystemDefaultValues() {
 	// r.VelDeceLim = 50
 	// r.SpeedLimitGrade = -1
 
+	p.Ride.UTCOffset = noUTCOffset
+	p.Ride.CutFrom = -1
+	p.Ride.CutTo = -1
+	p.Ride.TurnAround = -1
+	p.Ride.Laps = 1
+
+	e.WindHeight = 10
+	e.Terrain = ""
+	e.RelativeHumidity = -1
+	e.DewPoint = noDewPoint
+	e.MoistAir = 1
+
+	g := &p.Group
+	g.Size = 1
+	g.PullFraction = -1
+	g.PullTime = -1
+	g.PullDist = -1
+	g.DraftCdA = 65
+
+	t := &p.Fatigue
+	t.CP = -1
+	t.WPrime = 20
+	t.CapBalance = 10
+	t.EnduranceDecay = 0
+
+	// https://fineli.fi/fineli/en/elintarvikkeet/11049?portionUnit=KPL_M&portionSize=1
+	// Banana, without skin: 1 medium sized piece 125 g = 458 kJ
+	// Lard, Frying Fat 3591 kJ / 100 g
+	// Lord is a semi-solid white fat product obtained by rendering
+	// the fatty tissue of a pig. It is distinguished from tallow,
+	// a similar product derived from fat of cattle or sheep.
+	// Tallow, Beef Fat: 3,684 kJ / 100 g
+	n := &p.Nutrition
+	n.CarbsPerHour = 60
+	n.FeedInterval = 0
+	n.SweatRate = -1
+	n.WaypointSnap = 3
+	n.Foods = []food{{"Bananas", "pcs", 458}, {"Lard", "g", 35.91}}
+
+	s := &p.RestStops
+	s.EveryTime = 0
+	s.EveryDist = 0
+	s.Duration = 15
+	s.WaypointSnap = 2
+
+	d := &p.Gearing
+	d.WheelCircumference = 2100
+	d.MinCadence = 50
+	d.MaxCadence = 110
+
+	w := &p.Walking
+	w.Grade = -1
+	w.PowerLimit = -1
+	w.MaxSpeed = 6
+	w.Cost = 0.5
+
+	b := &p.Ebike
+	b.Assist = 0
+	b.MaxPower = 250
+	b.CutoffSpeed = 25
+	b.Efficiency = 80
+	b.Battery = 500
+	b.Regen = 0
+	b.MaxRegenPower = 250
+	b.RegenSpeed = -1
+
+	h := &p.Histograms
+	h.FTP = -1
+	h.PowerZones = []float64{55, 75, 90, 105, 120, 150} // Coggan zones 1-7
+
 	u.PowerLimit = 90
 	u.ClimbDuration = 0
 	u.BreakDuration = 0
@@ -174,6 +252,10 @@ type attributes struct {
 
 const mustGiven = 0.18471183528821574770795166386961
 
+const noDewPoint = -999
+
+const noUTCOffset = -99
+
 type attributesMap map[string]attributes
 
 func (m attributesMap) put(key string, min, max float64, unit string, notGiven float64) {
@@ -212,6 +294,9 @@ func setParamRanges() attributesMap {
 	m.put("temperature", -25, 50, "deg C", mustGiven)
 	m.put("airPressure", 950, 1085, "hPascals", -1)
 	m.put("baseElevation", 0, 5000, "m", -1)
+	m.put("windHeight", 2, 100, "m", mustGiven)
+	m.put("relativeHumidity", 0, 100, "%", -1)
+	m.put("dewPoint", -40, 35, "deg C", noDewPoint)
 
 	// Powermodel
 	m.put("flatGroundSpeed", 10, 60, "km/h", -1)
@@ -232,6 +317,9 @@ func setParamRanges() attributesMap {
 	m.put("headWindPower", 80, 150, "%", mustGiven)
 	m.put("downhillHeadwindPower", 50, 125, "%", -1)
 	m.put("downhillTailwindPower", 1, 20, "%", -1)
+	m.put("altitudeModel", 0, 3, "", mustGiven)
+	m.put("altitudePowerLoss", 0, 30, "%/1000 m", mustGiven)
+	m.put("acclimatisationAltitude", 0, 5000, "m", mustGiven)
 
 	// Bike
 	m.put("rollingResistanceCoef", 0.0001, 0.04, "", -1)
@@ -241,6 +329,57 @@ func setParamRanges() attributesMap {
 	m.put("drivetrainLoss", 0, 20, "%", mustGiven)
 	m.put("weight.total", 40, 10000, "kg", -1)
 
+	// Group ride
+	m.put("groupSize", 1, 100, "", mustGiven)
+	m.put("pullFraction", 1, 100, "%", -1)
+	m.put("pullTime", 0.1, 120, "min", -1)
+	m.put("pullDistance", 0.05, 100, "km", -1)
+	m.put("draftCdA", 30, 100, "%", mustGiven)
+
+	// Fatigue
+	m.put("criticalPower", 50, 600, "w", -1)
+	m.put("wPrime", 1, 60, "kJ", mustGiven)
+	m.put("capBalance", 0, 100, "%", mustGiven)
+	m.put("enduranceDecay", 0, 10, "%/h", mustGiven)
+
+	// Nutrition
+	m.put("carbsPerHour", 0, 150, "g/h", mustGiven)
+	m.put("feedInterval", 0, 240, "min", mustGiven)
+	m.put("sweatRate", 0, 4, "l/h", -1)
+	m.put("waypointSnap", 0, 50, "km", mustGiven)
+	m.put("carriedFood", 0, 20, "kg", mustGiven)
+	m.put("carriedWater", 0, 20, "kg", mustGiven)
+
+	// Rest stops
+	m.put("restStops.everyTime", 0, 24, "h", mustGiven)
+	m.put("restStops.everyDistance", 0, 1000, "km", mustGiven)
+	m.put("restStops.duration", 1, 600, "min", mustGiven)
+	m.put("restStops.waypointSnap", 0, 50, "km", mustGiven)
+
+	// Gearing
+	m.put("wheelCircumference", 1000, 2600, "mm", mustGiven)
+	m.put("minCadence", 20, 120, "rpm", mustGiven)
+	m.put("maxCadence", 40, 200, "rpm", mustGiven)
+
+	// Walking
+	m.put("walkGrade", 5, 60, "%", -1)
+	m.put("walkPowerLimit", 50, 300, "%", -1)
+	m.put("walkMaxSpeed", 2, 8, "km/h", mustGiven)
+	m.put("walkCost", 0, 3, "J/kg/m", mustGiven)
+
+	// E-bike
+	m.put("assist", 0, 400, "%", mustGiven)
+	m.put("maxMotorPower", 50, 1000, "w", mustGiven)
+	m.put("assistCutoffSpeed", 10, 50, "km/h", mustGiven)
+	m.put("motorEfficiency", 50, 100, "%", mustGiven)
+	m.put("batteryCapacity", 50, 3000, "Wh", mustGiven)
+	m.put("regenBraking", 0, 80, "%", mustGiven)
+	m.put("maxRegenPower", 50, 1000, "w", mustGiven)
+	m.put("regenDescentSpeed", 10, 80, "km/h", -1)
+
+	// Histograms
+	m.put("FTP", 50, 600, "w", -1)
+
 	// Ride
 	m.put("maxSpeed", 20, 1000, "km/h", mustGiven)
 	m.put("minSpeed", 3, 20, "km/h", -1)
@@ -250,6 +389,11 @@ func setParamRanges() attributesMap {
 	m.put("minAccelerationPower", 0, 200, "w", -1)
 	m.put("keepEntrySpeed", 1, 25, "%", -1)
 	m.put("velDeceLim", 0, 100, "", mustGiven)
+	m.put("utcOffset", -12, 14, "h", noUTCOffset)
+	m.put("cutFrom", 0, 10000, "km", -1)
+	m.put("cutTo", 0.1, 10000, "km", -1)
+	m.put("turnAround", 0.1, 10000, "km", -1)
+	m.put("laps", 1, 100, "", mustGiven)
 
 	// uphill breaks
 	m.put("uphillBreak.powerLimit", 75, 95, "%", -1)
@@ -295,8 +439,60 @@ func checkParamRanges(p *Parameters, m attributesMap, l logger) {
 	m.check(e.Temperature, "temperature", l)
 	m.check(e.AirPressure, "airPressure", l)
 	m.check(e.BaseElevation, "baseElevation", l)
+	m.check(e.WindHeight, "windHeight", l)
+	m.check(e.RelativeHumidity, "relativeHumidity", l)
+	m.check(e.DewPoint, "dewPoint", l)
 
 	m.check(p.Bike.Crr, "rollingResistanceCoef", l)
+
+	g := &p.Group
+	m.check(float64(g.Size), "groupSize", l)
+	m.check(g.PullFraction, "pullFraction", l)
+	m.check(g.PullTime, "pullTime", l)
+	m.check(g.PullDist, "pullDistance", l)
+	m.check(g.DraftCdA, "draftCdA", l)
+
+	t := &p.Fatigue
+	m.check(t.CP, "criticalPower", l)
+	m.check(t.WPrime, "wPrime", l)
+	m.check(t.CapBalance, "capBalance", l)
+	m.check(t.EnduranceDecay, "enduranceDecay", l)
+
+	n := &p.Nutrition
+	m.check(n.CarbsPerHour, "carbsPerHour", l)
+	m.check(n.FeedInterval, "feedInterval", l)
+	m.check(n.SweatRate, "sweatRate", l)
+	m.check(n.WaypointSnap, "waypointSnap", l)
+	m.check(n.CarriedFood, "carriedFood", l)
+	m.check(n.CarriedWater, "carriedWater", l)
+
+	s := &p.RestStops
+	m.check(s.EveryTime, "restStops.everyTime", l)
+	m.check(s.EveryDist, "restStops.everyDistance", l)
+	m.check(s.Duration, "restStops.duration", l)
+	m.check(s.WaypointSnap, "restStops.waypointSnap", l)
+
+	d := &p.Gearing
+	m.check(d.WheelCircumference, "wheelCircumference", l)
+	m.check(d.MinCadence, "minCadence", l)
+	m.check(d.MaxCadence, "maxCadence", l)
+
+	w := &p.Walking
+	m.check(w.Grade, "walkGrade", l)
+	m.check(w.PowerLimit, "walkPowerLimit", l)
+	m.check(w.MaxSpeed, "walkMaxSpeed", l)
+	m.check(w.Cost, "walkCost", l)
+
+	b := &p.Ebike
+	m.check(b.Assist, "assist", l)
+	m.check(b.MaxPower, "maxMotorPower", l)
+	m.check(b.CutoffSpeed, "assistCutoffSpeed", l)
+	m.check(b.Efficiency, "motorEfficiency", l)
+	m.check(b.Battery, "batteryCapacity", l)
+	m.check(b.Regen, "regenBraking", l)
+	m.check(b.MaxRegenPower, "maxRegenPower", l)
+	m.check(b.RegenSpeed, "regenDescentSpeed", l)
+	m.check(p.Histograms.FTP, "FTP", l)
 	m.check(p.Bike.CdA, "airDragCoef CdA", l)
 	m.check(p.Bike.DrivetrainLoss, "drivetrainLoss", l)
 	m.check(p.Bike.Cbf, "brakeRoadFriction", l)
@@ -311,6 +507,9 @@ func checkParamRanges(p *Parameters, m attributesMap, l logger) {
 	m.check(q.UphillPowerSpeed, "uphillPowerSpeed", l)
 	m.check(q.UphillPowerGrade, "uphillPowerGrade", l)
 	m.check(q.MaxPedaledSpeed, "maxPedaledSpeed", l)
+	m.check(float64(q.AltitudeModel), "altitudeModel", l)
+	m.check(q.AltitudeLoss, "altitudePowerLoss", l)
+	m.check(q.AcclimAltitude, "acclimatisationAltitude", l)
 	m.check(q.TailWindPower, "tailWindPower", l)
 	m.check(q.SysTailwind, "sysTailWind", l)
 	m.check(q.SysHeadwind, "sysHeadwind", l)
@@ -329,6 +528,11 @@ func checkParamRanges(p *Parameters, m attributesMap, l logger) {
 	m.check(r.MinLimitedSpeed, "minLimitedSpeed", l)
 	m.check(r.VerticalDownSpeed, "verticalDownSpeed", l)
 	m.check(r.BrakingDist, "brakingDist", l)
+	m.check(r.UTCOffset, "utcOffset", l)
+	m.check(r.CutFrom, "cutFrom", l)
+	m.check(r.CutTo, "cutTo", l)
+	m.check(r.TurnAround, "turnAround", l)
+	m.check(float64(r.Laps), "laps", l)
 	m.check(r.KeepEntrySpeed, "keepEntrySpeed", l)
 
 	u := &p.UphillBreak
@@ -396,6 +600,80 @@ func (p *Parameters) Check(l logger) error {
 	if b.Weight.Total <= 0 {
 		b.Weight.Total = b.Weight.Bike + b.Weight.Rider + b.Weight.Luggage
 	}
+	b.Weight.Total += p.Nutrition.CarriedFood + p.Nutrition.CarriedWater
+	for _, f := range p.Nutrition.Foods {
+		if f.Name == "" || f.Energy <= 0 {
+			l.Err("foods: name and energy > 0 needed")
+			break
+		}
+	}
+	for i, y := range b.YawCdA {
+		if y[0] < 0 || y[0] > 180 || y[1] <= 0 || i > 0 && y[0] <= b.YawCdA[i-1][0] {
+			l.Err("yawCdA: yaw angles must be increasing in [0, 180] and ratios > 0")
+			break
+		}
+	}
+	if e := p.parseStartTime(l); e != nil {
+		l.Err(e)
+	}
+	if p.Environment.WindForecast != "" && p.Ride.StartTime == "" {
+		l.Err("windForecastFile given and no ride startTime")
+	}
+	if !validTerrain(p.Environment.Terrain) {
+		l.Err("terrain", p.Environment.Terrain, "is not open, suburban or forest")
+	}
+	for _, t := range p.Environment.TerrainSections {
+		if !validTerrain(t.Terrain) || t.Terrain == "" || t.From >= t.To {
+			l.Err("terrainSections: bad section", t.From, "-", t.To, "km", t.Terrain)
+		}
+	}
+	if e := &p.Environment; e.RelativeHumidity >= 0 && e.DewPointGiven() {
+		l.Err("relativeHumidity and dewPoint both given")
+	}
+	if e := &p.Environment; e.AirDensity > 0 && (e.RelativeHumidity >= 0 || e.DewPointGiven()) {
+		l.Err("airDensity given with relativeHumidity or dewPoint")
+	}
+	if e := &p.Environment; e.DewPointGiven() && e.DewPoint > e.Temperature {
+		l.Err("dewPoint > temperature")
+	}
+	if g := &p.Group; g.Size > 1 && (g.PullTime > 0) == (g.PullDist > 0) {
+		l.Err("groupRide: give pullTime or pullDistance")
+	}
+	if r := &p.Ride; r.CutFrom >= 0 && r.CutFromWaypoint != "" || r.CutTo >= 0 && r.CutToWaypoint != "" {
+		l.Err("route cut: give distance or waypoint")
+	}
+	if r := &p.Ride; r.CutFrom >= 0 && r.CutTo >= 0 && r.CutFrom >= r.CutTo {
+		l.Err("cutFrom >= cutTo")
+	}
+	if r := &p.Ride; r.TurnAround > 0 && r.RoundTrip {
+		l.Err("turnAround and roundTrip both given")
+	}
+	if q := &p.Powermodel; q.PowermodelType == 5 && q.RatioTableFile == "" {
+		l.Err("powerModel 5 and no ratioTableFile")
+	}
+	if q := &p.Powermodel; q.PowermodelType == 6 && len(q.SpeedSchedule.Grade) == 0 {
+		l.Err("powerModel 6 and no speedSchedule")
+	}
+	if b := &p.Ebike; b.Assist <= 0 && (b.Regen > 0 || b.RegenSpeed > 0) {
+		l.Err("eBike: regeneration and no motor assist")
+	}
+	if h := &p.Histograms; !sort.Float64sAreSorted(h.PowerZones) ||
+		!sort.Float64sAreSorted(h.SpeedBands) || !sort.Float64sAreSorted(h.GradeBands) {
+		l.Err("histograms: zones and bands must be in increasing order")
+	}
+	if d := &p.Gearing; d.MinCadence >= d.MaxCadence {
+		l.Err("gearing: minCadence >= maxCadence")
+	}
+	if len(p.RestStops.Meals) > 0 && p.Ride.StartTime == "" {
+		l.Err("restStops meals given and no ride startTime")
+	}
+	p.parseMeals(l)
+	if p.Environment.TemperatureDayRange > 0 && p.Ride.StartTime == "" {
+		l.Err("temperatureDayRange given and no ride startTime")
+	}
+	if p.Environment.WindForecast != "" && p.Environment.WindField != "" {
+		l.Err("windForecastFile and windFieldFile both given")
+	}
 	if p.CheckParams {
 		m := setParamRanges()
 		checkParamRanges(p, m, l)
@@ -406,6 +684,47 @@ func (p *Parameters) Check(l logger) error {
 	return nil
 }
 
+// DewPointGiven reports whether the dew point is given.
+func (e *environment) DewPointGiven() bool { return e.DewPoint != noDewPoint }
+
+// UTCOffsetGiven reports whether the UTC offset is given.
+func (r *ride) UTCOffsetGiven() bool { return r.UTCOffset != noUTCOffset }
+
+func validTerrain(terrain string) bool {
+	switch terrain {
+	case "", "open", "suburban", "forest":
+		return true
+	}
+	return false
+}
+
+func (p *Parameters) parseStartTime(l logger) error {
+	r := &p.Ride
+	if r.StartTime == "" {
+		return nil
+	}
+	t, err := weather.ParseTime(r.StartTime)
+	if err != nil {
+		return l.Errorf("startTime %q: unknown time format, use e.g. 2024-05-18 08:30", r.StartTime)
+	}
+	r.Start = t
+	return nil
+}
+
+// parseMeals parses the meal stop clock times and sorts the meals by them.
+func (p *Parameters) parseMeals(l logger) {
+	meals := p.RestStops.Meals
+	for i := range meals {
+		t, err := time.Parse("15:04", meals[i].At)
+		if err != nil || meals[i].Duration <= 0 {
+			l.Errorf("restStops meal %q: give at as hh:mm and duration > 0", meals[i].At)
+			continue
+		}
+		meals[i].Clock = float64(t.Hour()*3600 + t.Minute()*60)
+	}
+	sort.Slice(meals, func(i, j int) bool { return meals[i].Clock < meals[j].Clock })
+}
+
 func (p *Parameters) UnitConversionIn() {
 
 	p.PowerIn = (100 - p.Bike.DrivetrainLoss) / 100
@@ -422,9 +741,18 @@ func (p *Parameters) UnitConversionIn() {
 	q.UphillPowerSpeed *= kmh2ms
 	q.UphillPowerGrade /= 100
 	q.DownhillPowerGrade /= 100
+	q.AltitudeLoss /= 100
 	//DrivetrainLoss is removed immediately and returned to the results
 	q.FlatPower *= p.PowerIn
 	q.UphillPower *= p.PowerIn
+	for i := range q.SpeedSchedule.Grade {
+		q.SpeedSchedule.Grade[i] /= 100
+	}
+	for _, row := range q.SpeedSchedule.Speed {
+		for j := range row {
+			row[j] *= kmh2ms
+		}
+	}
 
 	u.PowerLimit /= 100
 	u.ClimbDuration *= min2sec
@@ -445,6 +773,76 @@ func (p *Parameters) UnitConversionIn() {
 	r.SteepDownhillGrade /= 100
 	r.SpeedLimitGrade /= 100
 	r.PowerAcceMin *= p.PowerIn
+	r.CutFrom *= 1000
+	r.CutTo *= 1000
+	r.TurnAround *= 1000
+
+	g := &p.Group
+	if g.PullFraction <= 0 {
+		g.PullFraction = 100 / float64(max(g.Size, 1))
+	}
+	g.PullFraction /= 100
+	g.PullTime *= min2sec
+	g.PullDist *= 1000
+	g.DraftCdA /= 100
+
+	t := &p.Fatigue
+	t.CP *= p.PowerIn
+	t.WPrime *= 1000 * p.PowerIn
+	t.CapBalance /= 100
+	t.EnduranceDecay /= 100
+
+	n := &p.Nutrition
+	n.FeedInterval *= min2sec
+
+	s := &p.RestStops
+	s.EveryTime *= 3600
+	s.EveryDist *= 1000
+	s.Duration *= min2sec
+	s.WaypointSnap *= 1000
+	for i := range s.Meals {
+		s.Meals[i].Duration *= min2sec
+	}
+
+	d := &p.Gearing
+	d.WheelCircumference /= 1000
+	d.MinCadence *= sec2min
+	d.MaxCadence *= sec2min
+
+	w := &p.Walking
+	w.Grade /= 100
+	w.PowerLimit /= 100
+	w.MaxSpeed *= kmh2ms
+
+	b := &p.Ebike
+	b.Assist /= 100
+	b.CutoffSpeed *= kmh2ms
+	b.Efficiency /= 100
+	b.Battery *= 3600
+	b.Regen /= 100
+	b.RegenSpeed *= kmh2ms
+
+	h := &p.Histograms
+	h.FTP *= p.PowerIn
+	for i := range h.PowerZones {
+		h.PowerZones[i] /= 100
+	}
+	for i := range h.SpeedBands {
+		h.SpeedBands[i] *= kmh2ms
+	}
+	for i := range h.GradeBands {
+		h.GradeBands[i] /= 100
+	}
+	n.WaypointSnap *= 1000
+	for i := range n.Foods {
+		n.Foods[i].Energy *= 1000
+	}
+
+	for i := range p.Environment.TerrainSections {
+		t := &p.Environment.TerrainSections[i]
+		t.From *= 1000
+		t.To *= 1000
+	}
 }
 
 func (p *Parameters) UnitConversionOut() {
@@ -460,9 +858,18 @@ func (p *Parameters) UnitConversionOut() {
 	q.MaxPedaledSpeed *= ms2kmh
 	q.UphillPowerGrade *= 100
 	q.DownhillPowerGrade *= 100
+	q.AltitudeLoss *= 100
 	q.MinPedaledGrade *= 100
 	q.FlatPower *= p.PowerOut
 	q.UphillPower *= p.PowerOut
+	for i := range q.SpeedSchedule.Grade {
+		q.SpeedSchedule.Grade[i] *= 100
+	}
+	for _, row := range q.SpeedSchedule.Speed {
+		for j := range row {
+			row[j] *= ms2kmh
+		}
+	}
 
 	u.PowerLimit *= 100
 	u.ClimbDuration *= sec2min
@@ -483,4 +890,71 @@ func (p *Parameters) UnitConversionOut() {
 	r.SteepDownhillGrade *= 100
 	r.SpeedLimitGrade *= 100
 	r.PowerAcceMin *= p.PowerOut
+	r.CutFrom /= 1000
+	r.CutTo /= 1000
+	r.TurnAround /= 1000
+
+	g := &p.Group
+	g.PullFraction *= 100
+	g.PullTime *= sec2min
+	g.PullDist /= 1000
+	g.DraftCdA *= 100
+
+	t := &p.Fatigue
+	t.CP *= p.PowerOut
+	t.WPrime *= p.PowerOut / 1000
+	t.CapBalance *= 100
+	t.EnduranceDecay *= 100
+
+	n := &p.Nutrition
+	n.FeedInterval *= sec2min
+
+	s := &p.RestStops
+	s.EveryTime /= 3600
+	s.EveryDist /= 1000
+	s.Duration *= sec2min
+	s.WaypointSnap /= 1000
+	for i := range s.Meals {
+		s.Meals[i].Duration *= sec2min
+	}
+
+	d := &p.Gearing
+	d.WheelCircumference *= 1000
+	d.MinCadence *= min2sec
+	d.MaxCadence *= min2sec
+
+	w := &p.Walking
+	w.Grade *= 100
+	w.PowerLimit *= 100
+	w.MaxSpeed *= ms2kmh
+
+	b := &p.Ebike
+	b.Assist *= 100
+	b.CutoffSpeed *= ms2kmh
+	b.Efficiency *= 100
+	b.Battery /= 3600
+	b.Regen *= 100
+	b.RegenSpeed *= ms2kmh
+
+	h := &p.Histograms
+	h.FTP *= p.PowerOut
+	for i := range h.PowerZones {
+		h.PowerZones[i] *= 100
+	}
+	for i := range h.SpeedBands {
+		h.SpeedBands[i] *= ms2kmh
+	}
+	for i := range h.GradeBands {
+		h.GradeBands[i] *= 100
+	}
+	n.WaypointSnap /= 1000
+	for i := range n.Foods {
+		n.Foods[i].Energy /= 1000
+	}
+
+	for i := range p.Environment.TerrainSections {
+		t := &p.Environment.TerrainSections[i]
+		t.From /= 1000
+		t.To /= 1000
+	}
 }
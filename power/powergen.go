@@ -7,14 +7,14 @@ const (
 	simpleLinearModel      = 2
 	fullExponentialModel   = 3
 	fullLinearModel        = 4
+	ratioTableModel        = 5
+	speedScheduleModel     = 6
 	useMathExp             = false
 	useFMA                 = true
 )
 
 var ln = math.Log
 
-var ratioModel func(*Generator, float64, float64) float64
-
 type Generator struct {
 	βU  float64
 	βD  float64
@@ -50,6 +50,11 @@ type Generator struct {
 	powerModelType   int
 	logPowerUpRatio  float64
 	logPowerMinRatio float64
+
+	ratioModel func(*Generator, float64, float64) float64 // set by Setup
+
+	table    *RatioTable    // ratio table model
+	schedule *SpeedSchedule // speed schedule model
 }
 
 func RatioGenerator() *Generator {
@@ -94,19 +99,25 @@ func (m *Generator) Setup() {
 	switch m.powerModelType {
 	case simpleExponentialModel:
 		m.initSimpleExponential()
-		ratioModel = (*Generator).simpleExponential
+		m.ratioModel = (*Generator).simpleExponential
 
 	case simpleLinearModel:
 		m.initSimpleLinear()
-		ratioModel = (*Generator).simpleLinear
+		m.ratioModel = (*Generator).simpleLinear
 
 	case fullExponentialModel:
 		m.initFullExponential()
-		ratioModel = (*Generator).fullExponential
+		m.ratioModel = (*Generator).fullExponential
 
 	case fullLinearModel:
 		m.initFullLinear()
-		ratioModel = (*Generator).fullLinear
+		m.ratioModel = (*Generator).fullLinear
+
+	case ratioTableModel:
+		m.ratioModel = (*Generator).tableRatio
+
+	case speedScheduleModel:
+		m.ratioModel = (*Generator).scheduleRatio
 	}
 }
 
@@ -118,7 +129,7 @@ func (m *Generator) Ratio(grade, wind float64) (power float64) {
 	if wind != 0 {
 		wind = m.cutWind(grade, wind)
 	}
-	return ratioModel(m, grade, wind)
+	return m.ratioModel(m, grade, wind)
 }
 
 func (m *Generator) cutWind(grade, wind float64) float64 {
@@ -0,0 +1,50 @@
+package power
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestGeneratorsConcurrent runs generators of all the formula models at the
+// same time. Run with -race.
+func TestGeneratorsConcurrent(t *testing.T) {
+	var (
+		gens []*Generator
+		want [][]float64
+	)
+	ratios := func(m *Generator) []float64 {
+		var r []float64
+		for g := -0.10; g <= 0.12; g += 0.01 {
+			for w := -8.0; w <= 8; w += 2 {
+				r = append(r, m.Ratio(g, w))
+			}
+		}
+		return r
+	}
+	for model := simpleExponentialModel; model <= fullLinearModel; model++ {
+		m := RatioGenerator()
+		m.PowerModelType(model)
+		m.Setup()
+		gens = append(gens, m)
+	}
+	for _, m := range gens {
+		want = append(want, ratios(m))
+	}
+	var wg sync.WaitGroup
+	for i, m := range gens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				got := ratios(m)
+				for k := range got {
+					if got[k] != want[i][k] {
+						t.Errorf("model %d ratio %d = %g, want %g", i+1, k, got[k], want[i][k])
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
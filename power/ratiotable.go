@@ -0,0 +1,153 @@
+package power
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pekkizen/bikeride/weather/grid"
+)
+
+// RatioTable is a user defined power ratio table. ratio[i][j] is the power
+// ratio to the flat ground power at grade[i] and wind[j]. Grades and winds
+// are in increasing order and the ratios are nondecreasing by grade.
+type RatioTable struct {
+	grade []float64
+	wind  []float64
+	ratio [][]float64
+}
+
+type jsonRatioTable struct {
+	Grade []float64   `json:"grade (%)"`
+	Wind  []float64   `json:"wind (m/s)"`
+	Ratio [][]float64 `json:"ratio"`
+}
+
+// ReadRatioTable reads a power ratio table file. Files with extension .json
+// are read as
+//
+//	{"grade (%)": [-4, 0, 4, 8], "wind (m/s)": [-5, 0, 5],
+//	 "ratio": [[0.1, 0.2, 0.6], [0.85, 1, 1.15], [1.3, 1.4, 1.5], [1.7, 1.7, 1.7]]}
+//
+// with a row of ratios for each grade, and other files as CSV with a header
+// line of the winds and a line of ratios for each grade
+//
+//	grade,-5,0,5
+//	-4,0.1,0.2,0.6
+//	0,0.85,1,1.15
+func ReadRatioTable(file string) (*RatioTable, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	t := &RatioTable{}
+	if strings.HasSuffix(strings.ToLower(file), ".json") {
+		err = t.parseJSON(data)
+	} else {
+		err = t.parseCSV(data)
+	}
+	if err == nil {
+		err = t.check()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	for i := range t.grade {
+		t.grade[i] /= 100
+	}
+	return t, nil
+}
+
+func (t *RatioTable) parseJSON(data []byte) error {
+	var f jsonRatioTable
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	t.grade, t.wind, t.ratio = f.Grade, f.Wind, f.Ratio
+	return nil
+}
+
+func (t *RatioTable) parseCSV(data []byte) error {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(rows) < 2 || len(rows[0]) < 2 {
+		return fmt.Errorf("header line of winds and grade lines needed")
+	}
+	atof := func(s string, line int) (float64, error) {
+		x, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return 0, fmt.Errorf("line %d: %v", line, err)
+		}
+		return x, nil
+	}
+	for _, s := range rows[0][1:] {
+		x, err := atof(s, 1)
+		if err != nil {
+			return err
+		}
+		t.wind = append(t.wind, x)
+	}
+	for i, row := range rows[1:] {
+		var x []float64
+		for _, s := range row {
+			v, err := atof(s, i+2)
+			if err != nil {
+				return err
+			}
+			x = append(x, v)
+		}
+		t.grade = append(t.grade, x[0])
+		t.ratio = append(t.ratio, x[1:])
+	}
+	return nil
+}
+
+func (t *RatioTable) check() error {
+	if len(t.grade) == 0 || len(t.wind) == 0 {
+		return fmt.Errorf("no grades or winds")
+	}
+	if !grid.Increasing(t.grade) || !grid.Increasing(t.wind) {
+		return fmt.Errorf("grades and winds must be in increasing order")
+	}
+	if len(t.ratio) != len(t.grade) {
+		return fmt.Errorf("ratio must have a row for each grade")
+	}
+	for i, row := range t.ratio {
+		if len(row) != len(t.wind) {
+			return fmt.Errorf("ratio rows must have a value for each wind")
+		}
+		for j, x := range row {
+			if x <= 0 {
+				return fmt.Errorf("ratios must be > 0")
+			}
+			if i > 0 && x < t.ratio[i-1][j] {
+				return fmt.Errorf("ratios must be nondecreasing by grade, wind %g m/s", t.wind[j])
+			}
+		}
+	}
+	return nil
+}
+
+// Ratio returns the bilinearly interpolated power ratio at grade and wind.
+func (t *RatioTable) Ratio(grade, wind float64) float64 {
+	return grid.At(t.grade, t.wind, t.ratio, grade, wind)
+}
+
+// tableRatio is the power ratio of the ratio table model. The ratio is
+// limited to the minimum and the uphill power ratios.
+func (m *Generator) tableRatio(grade, wind float64) float64 {
+	return min(max(m.table.Ratio(grade, wind), m.powerMinRatio), m.powerUpRatio)
+}
+
+// SetRatioTable sets the power ratio table of the ratio table model.
+func (m *Generator) SetRatioTable(t *RatioTable) { m.table = t }
@@ -0,0 +1,42 @@
+package power
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadRatioTable(t *testing.T) {
+	dir := t.TempDir()
+	csvFile := filepath.Join(dir, "ratio.csv")
+	data := "grade,-5,0,5\n-4,0.1,0.2,0.6\n0,0.85,1,1.15\n4,1.3,1.4,1.5\n"
+	if err := os.WriteFile(csvFile, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tb, err := ReadRatioTable(csvFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ grade, wind, want float64 }{
+		{0, 0, 1},
+		{0.02, 0, 1.2},
+		{0, 2.5, 1.075},
+		{0.02, 2.5, 1.2625},
+		{-0.10, -9, 0.1}, // clamped to the table edges
+		{0.10, 9, 1.5},
+	}
+	for _, x := range tests {
+		if got := tb.Ratio(x.grade, x.wind); math.Abs(got-x.want) > 1e-12 {
+			t.Errorf("Ratio(%g, %g) = %g, want %g", x.grade, x.wind, got, x.want)
+		}
+	}
+	bad := filepath.Join(dir, "bad.json")
+	data = `{"grade (%)": [0, 4], "wind (m/s)": [0], "ratio": [[1], [0.9]]}`
+	if err := os.WriteFile(bad, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadRatioTable(bad); err == nil {
+		t.Error("decreasing ratios by grade accepted")
+	}
+}
@@ -0,0 +1,78 @@
+package power
+
+import (
+	"fmt"
+
+	"github.com/pekkizen/bikeride/weather/grid"
+)
+
+// SpeedSchedule is the target speed table of the speed schedule pacing
+// model. speed[i][j] is the target speed (m/s) at grade[i] and wind[j].
+// Without winds the speeds are for all winds.
+type SpeedSchedule struct {
+	grade []float64
+	wind  []float64
+	speed [][]float64
+}
+
+// NewSpeedSchedule returns a speed schedule of the grades, the winds (m/s)
+// and the target speeds (m/s) with a row for each grade. The grades and the
+// winds must be in increasing order. The winds may be empty with a speed
+// for each grade.
+func NewSpeedSchedule(grade, wind []float64, speed [][]float64) (*SpeedSchedule, error) {
+	if len(wind) == 0 {
+		wind = []float64{0}
+	}
+	t := &SpeedSchedule{grade: grade, wind: wind, speed: speed}
+	switch {
+	case len(grade) == 0:
+		return nil, fmt.Errorf("no grades")
+	case !grid.Increasing(grade) || !grid.Increasing(wind):
+		return nil, fmt.Errorf("grades and winds must be in increasing order")
+	case len(speed) != len(grade):
+		return nil, fmt.Errorf("speed must have a row for each grade")
+	}
+	for _, row := range speed {
+		if len(row) != len(wind) {
+			return nil, fmt.Errorf("speed rows must have a value for each wind")
+		}
+		for _, v := range row {
+			if v <= 0 {
+				return nil, fmt.Errorf("speeds must be > 0")
+			}
+		}
+	}
+	return t, nil
+}
+
+// Vel returns the bilinearly interpolated target speed at grade and wind.
+func (t *SpeedSchedule) Vel(grade, wind float64) float64 {
+	return grid.At(t.grade, t.wind, t.speed, grade, wind)
+}
+
+// Grades returns the grades of the schedule.
+func (t *SpeedSchedule) Grades() []float64 { return t.grade }
+
+// scheduleRatio is the power ratio of the speed schedule model. The power
+// is solved from the target speed and the ratio is not used for it.
+func (m *Generator) scheduleRatio(grade, wind float64) float64 { return 1 }
+
+// SetSpeedSchedule sets the speed schedule of the speed schedule model.
+func (m *Generator) SetSpeedSchedule(t *SpeedSchedule) { m.schedule = t }
+
+// TargetVel returns the target speed of the speed schedule model at grade
+// and wind. ok is false for the power ratio models.
+func (m *Generator) TargetVel(grade, wind float64) (vel float64, ok bool) {
+	if m.powerModelType != speedScheduleModel || m.schedule == nil {
+		return 0, false
+	}
+	return m.schedule.Vel(grade, wind), true
+}
+
+// Schedule returns the speed schedule of the speed schedule model, or nil.
+func (m *Generator) Schedule() *SpeedSchedule {
+	if m.powerModelType != speedScheduleModel {
+		return nil
+	}
+	return m.schedule
+}
@@ -0,0 +1,53 @@
+package power
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSpeedSchedule(t *testing.T) {
+	grade := []float64{-0.04, 0, 0.04}
+	speed := [][]float64{{12, 14}, {7, 8}, {3, 4}}
+	tb, err := NewSpeedSchedule(grade, []float64{0, 4}, speed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ grade, wind, want float64 }{
+		{0, 0, 7},
+		{0.02, 0, 5},
+		{0, 2, 7.5},
+		{-0.02, 2, 10.25},
+		{-0.10, -9, 12}, // clamped to the table edges
+		{0.10, 9, 4},
+	}
+	for _, x := range tests {
+		if got := tb.Vel(x.grade, x.wind); math.Abs(got-x.want) > 1e-12 {
+			t.Errorf("Vel(%g, %g) = %g, want %g", x.grade, x.wind, got, x.want)
+		}
+	}
+	m := RatioGenerator()
+	m.PowerModelType(1)
+	m.SetSpeedSchedule(tb)
+	m.Setup()
+	if _, ok := m.TargetVel(0, 0); ok {
+		t.Error("TargetVel ok for powerModel 1")
+	}
+	m.PowerModelType(6)
+	m.Setup()
+	if v, ok := m.TargetVel(0.02, 0); !ok || v != 5 {
+		t.Errorf("TargetVel(0.02, 0) = %g, %v, want 5, true", v, ok)
+	}
+	noWind, err := NewSpeedSchedule(grade, nil, [][]float64{{12}, {7}, {3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := noWind.Vel(0.02, 5); v != 5 {
+		t.Errorf("Vel without winds = %g, want 5", v)
+	}
+	if _, err := NewSpeedSchedule(grade, nil, [][]float64{{12}, {0}, {3}}); err == nil {
+		t.Error("zero speed accepted")
+	}
+	if _, err := NewSpeedSchedule([]float64{0, -0.04}, nil, [][]float64{{7}, {12}}); err == nil {
+		t.Error("decreasing grades accepted")
+	}
+}
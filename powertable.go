@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/pekkizen/bikeride/gpx"
+	"github.com/pekkizen/bikeride/logerr"
+	"github.com/pekkizen/bikeride/param"
+	"github.com/pekkizen/bikeride/power"
+	"github.com/pekkizen/bikeride/route"
+
+	"github.com/pekkizen/motion"
+)
+
+/*
+The power-table command tabulates the power ratio Ratio(grade, wind) of the
+ride parameter powermodel section and the resulting target speed and power
+over a grade x wind grid for the four formula model types side by side:
+
+	bikeride power-table ride.json [-gpx route.gpx] [-cfg config.json]
+
+The route is used for the air density and the gravity as in a ride. The
+target speed and power are as in a ride without the segment speed limits:
+freewheeling if the freewheel speed is over maxPedaledSpeed and limited by
+maxPedaledSpeed and minSpeed. The table is written to the result directory
+as <route name>_power_table.csv and plotted as _power_table.svg with the
+ratio and the target speed by grade for each wind.
+*/
+
+var (
+	tableGrades = gridRange(-10, 14, 1) // %
+	tableWinds  = gridRange(-8, 8, 2)   // m/s, + headwind
+)
+
+const tableModels = 4 // formula models 1-4
+
+// powerTable is the ratio, target speed and power by model, grade and wind.
+type powerTable struct {
+	ratio [tableModels][][]float64
+	vel   [tableModels][][]float64 // km/h
+	power [tableModels][][]float64 // W
+}
+
+func gridRange(from, to, step float64) []float64 {
+	var s []float64
+	for x := from; x <= to+step/2; x += step {
+		s = append(s, x)
+	}
+	return s
+}
+
+func powerTableCmd(args []string, l *logerr.Logerr) {
+	if len(args) < 3 {
+		l.Err("power-table: give a ride parameter file")
+		return
+	}
+	p, e := readParameters(append([]string{args[0]}, args[2:]...), l)
+	if e != nil {
+		return
+	}
+	gpz, e := gpx.New(p.GPXdir+p.GPXfile, p.GPXuseXMLparser, p.GPXignoreErrors)
+	if e != nil {
+		l.Err(e)
+		return
+	}
+	p.UnitConversionIn()
+	rou, e := route.New(gpz, p)
+	if e != nil {
+		l.Err(e)
+		return
+	}
+	cal := motion.Calculator()
+	gen := power.RatioGenerator()
+	if e := setupSystem(cal, gen, p, rou, l); e != nil {
+		l.Err(e)
+		return
+	}
+	t, e := makePowerTable(cal, p)
+	if e != nil {
+		l.Err("power-table:", e)
+		return
+	}
+	b := t.makeCSV(p.CSVuseTab, p.UseCR)
+	if p.Display {
+		l.Printf("%s", b)
+	}
+	write := func(suffix string, b []byte) {
+		w, e := writer(p, suffix)
+		if e == nil {
+			_, e = w.Write(b)
+			if e == nil {
+				e = w.Close()
+			}
+		}
+		if e != nil {
+			l.Err("Power table "+suffix+":", e)
+		}
+	}
+	write("_power_table.csv", b)
+	write("_power_table.svg", t.makeSVG())
+}
+
+// makePowerTable returns the power table of the model types 1-4 with the
+// other powermodel parameters of p, or the power model setup error.
+func makePowerTable(c *motion.BikeCalc, p *param.Parameters) (*powerTable, error) {
+	var (
+		t     = &powerTable{}
+		q     = &p.Powermodel
+		model = q.PowermodelType
+	)
+	defer func() { q.PowermodelType = model }()
+
+	for k := range tableModels {
+		q.PowermodelType = k + 1
+		gen := power.RatioGenerator()
+		if err := setupPowerModel(gen, p); err != nil {
+			return nil, fmt.Errorf("power model %d: %v", k+1, err)
+		}
+		for _, g := range tableGrades {
+			var ratio, vel, pow []float64
+			for _, w := range tableWinds {
+				v, pw := targetVelAndPower(c, gen, p, g/100, w)
+				ratio = append(ratio, gen.Ratio(g/100, w))
+				vel = append(vel, v*ms2kmh)
+				pow = append(pow, pw*p.PowerOut)
+			}
+			t.ratio[k] = append(t.ratio[k], ratio)
+			t.vel[k] = append(t.vel[k], vel)
+			t.power[k] = append(t.power[k], pow)
+		}
+	}
+	return t, nil
+}
+
+// targetVelAndPower returns the target speed and power at grade and wind
+// as route.SetupRide without the segment speed limits. The speed is NaN if
+// it is not solvable.
+func targetVelAndPower(c *motion.BikeCalc, m *power.Generator, p *param.Parameters,
+	grade, wind float64) (vel, pow float64) {
+
+	q := &p.Powermodel
+	c.SetGradeExact(grade)
+	c.SetWind(wind)
+	if v := c.VelFreewheel(); v > q.MaxPedaledSpeed {
+		return v, 0
+	}
+	pow = q.FlatPower * m.Ratio(grade, wind)
+	vel, ok := c.VelFromPower(pow, -1)
+	switch {
+	case !ok:
+		return math.NaN(), pow
+	case vel < p.Ride.MinSpeed:
+		vel = p.Ride.MinSpeed
+		pow = c.PowerFromVel(vel)
+	case pow > 0 && vel > q.MaxPedaledSpeed:
+		vel = q.MaxPedaledSpeed
+		pow = c.PowerFromVel(vel)
+	}
+	return vel, pow
+}
+
+// makeCSV returns the table with a line for each grade and wind.
+func (t *powerTable) makeCSV(useTab, useCR bool) []byte {
+	sep, le := ",", "\n"
+	if useTab {
+		sep = "\t"
+	}
+	if useCR {
+		le = "\r\n"
+	}
+	b := []byte("grade (%)" + sep + "wind (m/s)")
+	for k := range tableModels {
+		m := strconv.Itoa(k + 1)
+		b = append(b, sep+"ratio "+m+sep+"speed "+m+" (km/h)"+sep+"power "+m+" (w)"...)
+	}
+	b = append(b, le...)
+	for i, g := range tableGrades {
+		for j, w := range tableWinds {
+			b = strconv.AppendFloat(b, g, 'f', -1, 64)
+			b = append(b, sep...)
+			b = strconv.AppendFloat(b, w, 'f', -1, 64)
+			for k := range tableModels {
+				b = append(b, sep...)
+				b = strconv.AppendFloat(b, t.ratio[k][i][j], 'f', 3, 64)
+				b = append(b, sep...)
+				b = strconv.AppendFloat(b, t.vel[k][i][j], 'f', 2, 64)
+				b = append(b, sep...)
+				b = strconv.AppendFloat(b, t.power[k][i][j], 'f', 1, 64)
+			}
+			b = append(b, le...)
+		}
+	}
+	return b
+}
+
+// makeSVG returns the ratio (upper row) and the target speed (lower row) by
+// grade for each model. The lines are the winds from tailwind (blue) to
+// headwind (red), calm in black.
+func (t *powerTable) makeSVG() []byte {
+	const (
+		panelW, panelH = 300.0, 220.0
+		margin         = 45.0
+	)
+	b := []byte(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%g" height="%g" `+
+		`font-family="sans-serif" font-size="11">`+"\n", tableModels*panelW, 2*panelH))
+	panel := func(b []byte, x0, y0 float64, data [][]float64, title string) []byte {
+		var (
+			gMin, gMax = tableGrades[0], tableGrades[len(tableGrades)-1]
+			yMin       = 0.0
+			yMax       = 0.0
+		)
+		for _, row := range data {
+			for _, v := range row {
+				if !math.IsNaN(v) {
+					yMax = max(yMax, v)
+				}
+			}
+		}
+		if yMax <= yMin {
+			yMax = 1
+		}
+		w, h := panelW-margin-10, panelH-2*margin
+		x := func(g float64) string { return ftoa(x0+margin+(g-gMin)/(gMax-gMin)*w, 1) }
+		y := func(v float64) string { return ftoa(y0+margin+h-(v-yMin)/(yMax-yMin)*h, 1) }
+		b = append(b, `<rect x="`+x(gMin)+`" y="`+y(yMax)+`" width="`+ftoa(w, 1)+
+			`" height="`+ftoa(h, 1)+`" fill="none" stroke="gray"/>`+"\n"...)
+		if gMin < 0 && gMax > 0 {
+			b = append(b, `<line x1="`+x(0)+`" y1="`+y(yMin)+`" x2="`+x(0)+`" y2="`+y(yMax)+
+				`" stroke="lightgray"/>`+"\n"...)
+		}
+		for j, wind := range tableWinds {
+			color := "black"
+			if s := wind / tableWinds[len(tableWinds)-1]; s > 0 {
+				color = fmt.Sprintf("rgb(%d,0,0)", int(80+175*s))
+			} else if s < 0 {
+				color = fmt.Sprintf("rgb(0,0,%d)", int(80-175*s))
+			}
+			b = append(b, `<polyline fill="none" stroke="`+color+`" points="`...)
+			for i, g := range tableGrades {
+				if v := data[i][j]; !math.IsNaN(v) {
+					b = append(b, x(g)+","+y(v)+" "...)
+				}
+			}
+			b = append(b, "\"/>\n"...)
+		}
+		label := func(b []byte, xs, ys, anchor, s string) []byte {
+			return append(b, `<text x="`+xs+`" y="`+ys+`" text-anchor="`+anchor+`">`+s+"</text>\n"...)
+		}
+		below := ftoa(y0+margin+h+15, 1)
+		b = label(b, x(gMin), below, "start", ftoa(gMin, 0)+" %")
+		b = label(b, x(gMax), below, "end", ftoa(gMax, 0)+" %")
+		b = label(b, ftoa(x0+margin-4, 1), y(yMin), "end", ftoa(yMin, 0))
+		b = label(b, ftoa(x0+margin-4, 1), y(yMax), "end", ftoa(yMax, 1))
+		return label(b, ftoa(x0+panelW/2, 1), ftoa(y0+margin-10, 1), "middle", title)
+	}
+	for k := range tableModels {
+		m := strconv.Itoa(k + 1)
+		b = panel(b, float64(k)*panelW, 0, t.ratio[k], "powerModel "+m+" ratio")
+		b = panel(b, float64(k)*panelW, panelH, t.vel[k], "powerModel "+m+" speed (km/h)")
+	}
+	return append(b, "</svg>\n"...)
+}
@@ -0,0 +1,81 @@
+package route
+
+import (
+	"math"
+
+	"github.com/pekkizen/motion"
+)
+
+/*
+The calculator air density is by default the air density at the route mean
+elevation. With airDensityBySegment each road segment gets the air density at
+its own elevation from the same RhoFromEle model. The base elevation
+temperature is the temperature parameter, the forecast temperature at the
+segment arrival time or a temperature by the time of the day:
+
+	T(h) = Tmax - range/2 * (1 - cos(2π(h - 15)/24))
+
+where Tmax is the temperature parameter at 15 h and range the daily
+temperature range.
+*/
+
+// SetTemperatureForecast sets a time varying base elevation temperature.
+func (o *Route) SetTemperatureForecast(t temperatureForecaster) { o.tempForecast = t }
+
+// segmentRho reports whether the air density is calculated by segment.
+func segmentRho(p par) bool {
+	return p.Environment.SegmentRho && p.Environment.AirDensity <= 0
+}
+
+// temperatureByTime reports whether the segment air density depends on
+// the arrival times.
+func (o *Route) temperatureByTime(p par) bool {
+	return segmentRho(p) && (o.tempForecast != nil || p.Environment.TemperatureDayRange > 0)
+}
+
+// setAirDensity sets the air density and temperature of the road segments
+// by the segment midpoint elevations and arrival times.
+func (o *Route) setAirDensity(c *motion.BikeCalc, p par) {
+	e := &p.Environment
+	o.rhoMin, o.rhoMax = math.MaxFloat64, 0
+	for i := 1; i <= o.segments; i++ {
+		s := &o.route[i]
+		c.SetTemperature(o.baseTemperature(s.timeArrival, p))
+		s.rho, s.temperature = c.RhoFromEle((s.ele + o.route[i+1].ele) / 2)
+		s.rho *= e.MoistAir
+		o.rhoMin = min(o.rhoMin, s.rho)
+		o.rhoMax = max(o.rhoMax, s.rho)
+	}
+	c.SetTemperature(e.Temperature)
+}
+
+// baseTemperature returns the base elevation temperature at time sec from
+// the ride start.
+func (o *Route) baseTemperature(sec float64, p par) float64 {
+	e := &p.Environment
+	if o.tempForecast != nil {
+		if t, ok := o.tempForecast.Temperature(sec); ok {
+			return t
+		}
+	}
+	if e.TemperatureDayRange <= 0 {
+		return e.Temperature
+	}
+	start := p.Ride.Start
+	h := float64(start.Hour()) + float64(start.Minute())/60 + float64(start.Second())/3600
+	h += sec / 3600
+	return e.Temperature - e.TemperatureDayRange/2*(1-math.Cos(2*π*(h-15)/24))
+}
+
+// setSegmentRhoTargetVel solves the segment target speed again with the
+// segment air density. The target speed time difference to the mean
+// elevation air density is added to the route.
+func (s *segment) setSegmentRhoTargetVel(c *motion.BikeCalc, p par, power ratioGenerator, o *Route) error {
+	vTarget := s.vTarget
+	c.SetRho(s.rho)
+	if e := s.setTargetVelAndPower(c, p, power); e != nil {
+		return e
+	}
+	o.timeRho += s.dist/s.vTarget - s.dist/vTarget
+	return nil
+}
@@ -0,0 +1,66 @@
+package route
+
+import "github.com/pekkizen/motion"
+
+/*
+Rider power decreases with altitude. The altitude power factor of a road
+segment is by the segment midpoint elevation h (km) and the acclimatisation
+altitude h0 (km). Below h0 the factor is 1. The models are
+
+	1: linear, 1 - loss * (h - h0), loss in 1/km
+	2: acclimatised, f(h)/f(h0), f(h) = 99.921 - 1.8991h - 1.1219h^2
+	3: non-acclimatised, f(h)/f(h0), f(h) = 100 - 4.0758h - 1.434h^2 + 0.1781h^3
+
+The curves 2 and 3 are the relative maximal aerobic power of Bassett et al.
+1999, Comparing cycling world hour records, 1967-1996: modeling with
+empirical data. The factor scales the target power and the acceleration power.
+*/
+
+const (
+	altitudeLinear = iota + 1
+	altitudeAcclim
+	altitudeNonAcclim
+)
+
+// altitudePower reports whether the rider power depends on altitude.
+func altitudePower(p par) bool { return p.Powermodel.AltitudeModel > 0 }
+
+// altitudePowerFactor returns the rider power factor at elevation ele (m).
+func altitudePowerFactor(p par, ele float64) float64 {
+	var (
+		q  = &p.Powermodel
+		h  = ele / 1000
+		h0 = q.AcclimAltitude / 1000
+	)
+	if h <= h0 {
+		return 1
+	}
+	switch q.AltitudeModel {
+	case altitudeLinear:
+		return max(0, 1-q.AltitudeLoss*(h-h0))
+	case altitudeAcclim:
+		f := func(h float64) float64 { return 99.921 - 1.8991*h - 1.1219*h*h }
+		return f(h) / f(h0)
+	case altitudeNonAcclim:
+		f := func(h float64) float64 { return 100 - 4.0758*h - 1.434*h*h + 0.1781*h*h*h }
+		return f(h) / f(h0)
+	}
+	return 1
+}
+
+// setAltitudeTargetVel sets the segment altitude power factor and solves
+// the target speed again with it. The target speed time lost to altitude
+// is added to the route.
+func (s *segment) setAltitudeTargetVel(c *motion.BikeCalc, p par, power ratioGenerator, o *Route, next *segment) error {
+	s.powerFactor = altitudePowerFactor(p, (s.ele+next.ele)/2)
+	o.powerFactMin = min(o.powerFactMin, s.powerFactor)
+	if s.powerFactor == 1 || s.powerTarget <= 0 {
+		return nil
+	}
+	vTarget := s.vTarget
+	if e := s.setTargetVelAndPower(c, p, power); e != nil {
+		return e
+	}
+	o.timeAltitude += s.dist/s.vTarget - s.dist/vTarget
+	return nil
+}
@@ -0,0 +1,180 @@
+package route
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pekkizen/bikeride/gpx"
+	"github.com/pekkizen/bikeride/logerr"
+)
+
+/*
+With the ride startTime the arrival time of each road segment is the start
+time plus the ride time and the uphill breaks before the segment. Clock times
+are local times. The UTC offset is from the startTime time zone, from the
+utcOffset parameter or estimated from the mean longitude.
+
+Sunrise and sunset are by the NOAA general solar position equations. The
+sunrise and sunset are when the sun's upper limb is at the horizon, with
+atmospheric refraction, i.e. the sun center is at 90.833 degrees zenith.
+*/
+
+const maxWaypointDist = 500.0 // m, farther waypoints are not on the route
+
+type waypoint struct {
+	name string
+	seg  int
+}
+
+// Waypoint is a GPX waypoint on the route with its arrival time.
+type Waypoint struct {
+	Name    string
+	Dist    float64 // km
+	Time    float64 // h from the start, breaks included
+	Arrival string  // clock time
+}
+
+// setWaypoints maps the GPX waypoints to the nearest road segment start point
+// of each pass of the route by the waypoint. A pass is within maxWaypointDist
+// and it ends when the route is twice as far, so on laps and round trips a
+// waypoint has an arrival time for each pass. The waypoints are in the route
+// order.
+func (o *Route) setWaypoints(wpts []gpx.Wpt) {
+	const (
+		onRoute = maxWaypointDist * maxWaypointDist
+		passed  = 4 * onRoute
+	)
+	for _, w := range wpts {
+		seg, minDist := 0, onRoute
+		for i := 1; i <= o.segments+2; i++ {
+			d := passed
+			if i <= o.segments+1 {
+				s := &o.route[i]
+				dLon := (w.Lon - s.lon) * o.metersLon
+				dLat := (w.Lat - s.lat) * o.metersLat
+				d = dLon*dLon + dLat*dLat
+			}
+			if d < minDist {
+				seg, minDist = i, d
+			} else if d >= passed && seg > 0 {
+				o.waypoints = append(o.waypoints, waypoint{name: w.Name, seg: seg})
+				seg, minDist = 0, onRoute
+			}
+		}
+	}
+	sort.SliceStable(o.waypoints, func(i, j int) bool {
+		return o.waypoints[i].seg < o.waypoints[j].seg
+	})
+}
+
+// clockStart returns the ride start clock time and the UTC offset (h).
+func (o *Route) clockStart(p par) (start time.Time, utcOffset float64) {
+	start = p.Ride.Start
+	if start.Location() != time.UTC {
+		_, sec := start.Zone()
+		return start, float64(sec) / 3600
+	}
+	if p.Ride.UTCOffsetGiven() {
+		return start, p.Ride.UTCOffset
+	}
+	return start, math.Round(o.lonMean / 15)
+}
+
+// clock returns the clock time sec seconds from the ride start.
+func clock(start time.Time, sec float64) time.Time {
+	return start.Add(time.Duration(sec * float64(time.Second)))
+}
+
+// finishTime returns the ride time from the start to the finish, breaks included.
+func (o *Route) finishTime() float64 {
+	last := &o.route[o.segments]
+	return last.rideStart() + last.time
+}
+
+// addClockTimes adds the waypoint arrival times, and with a ride start time,
+// the start and finish clock times, sunrise and sunset and the time
+// riding in the dark.
+func (r *Results) addClockTimes(o *Route, p par, l *logerr.Logerr) {
+	const clockFormat = "15:04:05"
+	var (
+		clockTimes = p.Ride.StartTime != ""
+		start, utc = o.clockStart(p)
+	)
+	cumDist := make([]float64, o.segments+2)
+	for i := 1; i <= o.segments; i++ {
+		cumDist[i+1] = cumDist[i] + o.route[i].dist
+	}
+	for _, w := range o.waypoints {
+		sec := o.finishTime()
+		if w.seg <= o.segments {
+			sec = o.route[w.seg].timeArrival
+		}
+		wp := Waypoint{Name: w.name, Dist: cumDist[w.seg] * m2km, Time: sec * s2h}
+		if clockTimes {
+			wp.Arrival = clock(start, sec).Format(clockFormat)
+		}
+		r.Waypoints = append(r.Waypoints, wp)
+	}
+	if !clockTimes {
+		return
+	}
+	r.UTCOffset = utc
+	r.StartClock = start.Format(clockFormat)
+	r.FinishClock = clock(start, o.finishTime()).Format(clockFormat)
+
+	rise, set, _ := sunriseSunset(start, o.LatMean, o.lonMean, utc)
+	r.Sunrise = hhmm(rise)
+	r.Sunset = hhmm(set)
+
+	day := -1
+	for i := 1; i <= o.segments; i++ {
+		s := &o.route[i]
+		t := clock(start, s.rideStart()+s.time/2)
+		if t.YearDay() != day {
+			day = t.YearDay()
+			rise, set, _ = sunriseSunset(t, o.LatMean, o.lonMean, utc)
+		}
+		if h := float64(t.Hour()) + float64(t.Minute())/60 + float64(t.Second())/3600; h < rise || h > set {
+			r.TimeDark += s.time
+		}
+	}
+	if r.TimeDark > 0 {
+		l.Msg(0, "Riding in the dark", hhmm(r.TimeDark*s2h), "(h:mm), sunrise",
+			r.Sunrise, "sunset", r.Sunset)
+	}
+}
+
+// sunriseSunset returns the sunrise and sunset local clock hours of the day
+// of t at latitude lat and longitude lon (deg). Under the midnight sun
+// the times are 0 and 24, and in the polar night both are 12. ok is false
+// for both.
+func sunriseSunset(t time.Time, lat, lon, utcOffset float64) (rise, set float64, ok bool) {
+	const zenith = 90.833 * (π / 180)
+	var (
+		γ       = 2 * π / 365 * float64(t.YearDay()-1)
+		eqTime  = 229.18 * (0.000075 + 0.001868*math.Cos(γ) - 0.032077*math.Sin(γ) - 0.014615*math.Cos(2*γ) - 0.040849*math.Sin(2*γ))
+		decl    = 0.006918 - 0.399912*math.Cos(γ) + 0.070257*math.Sin(γ) - 0.006758*math.Cos(2*γ) + 0.000907*math.Sin(2*γ) - 0.002697*math.Cos(3*γ) + 0.00148*math.Sin(3*γ)
+		latR    = lat * (π / 180)
+		cosHour = math.Cos(zenith)/(math.Cos(latR)*math.Cos(decl)) - math.Tan(latR)*math.Tan(decl)
+	)
+	switch {
+	case cosHour < -1:
+		return 0, 24, false
+	case cosHour > 1:
+		return 12, 12, false
+	}
+	hourAngle := math.Acos(cosHour) * (180 / π)
+	rise = (720-4*(lon+hourAngle)-eqTime)/60 + utcOffset // minutes to hours
+	set = (720-4*(lon-hourAngle)-eqTime)/60 + utcOffset
+	return rise, set, true
+}
+
+// hhmm formats hours as h:mm.
+func hhmm(hours float64) string {
+	m := int(math.Round(hours * 60))
+	b := strconv.AppendInt(nil, int64(m/60), 10)
+	b = append(b, ':', byte('0'+m%60/10), byte('0'+m%10))
+	return string(b)
+}
@@ -0,0 +1,170 @@
+package route
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/pekkizen/bikeride/gpx"
+)
+
+/*
+A route is composed from the GPX track points before the track point import,
+so the filters and the route statistics are for the composed route. Several
+GPX files are appended to one track before this. The composition steps are
+in the order
+
+	cut:         the part from cutFrom to cutTo (km), or from cutFromWaypoint
+	             to cutToWaypoint
+	turn around: out and back, the route to turnAround (km) and back
+	laps:        the route repeated laps times, the route must be a loop
+
+The distances are horizontal track distances from the route start. The cut
+and turnaround points are interpolated. A waypoint is at the nearest track
+point within maxWaypointDist.
+*/
+
+// composed reports whether the route is composed from the GPX track.
+func composed(p par) bool {
+	r := &p.Ride
+	return r.CutFrom >= 0 || r.CutTo >= 0 || r.CutFromWaypoint != "" ||
+		r.CutToWaypoint != "" || r.TurnAround > 0 || r.Laps > 1
+}
+
+// compose returns the composed track points. tps is not changed.
+func compose(tps []gpx.Trkpt, wpts []gpx.Wpt, p par) ([]gpx.Trkpt, error) {
+	var (
+		r    = &p.Ride
+		dist = trackDist(tps)
+		end  = dist[len(dist)-1]
+		from = max(r.CutFrom, 0)
+		to   = end
+	)
+	if r.CutTo >= 0 {
+		to = min(r.CutTo, end)
+	}
+	if r.CutFromWaypoint != "" {
+		i, err := waypointTrkpt(tps, wpts, r.CutFromWaypoint)
+		if err != nil {
+			return nil, err
+		}
+		from = dist[i]
+	}
+	if r.CutToWaypoint != "" {
+		i, err := waypointTrkpt(tps, wpts, r.CutToWaypoint)
+		if err != nil {
+			return nil, err
+		}
+		to = dist[i]
+	}
+	if from >= to {
+		return nil, errNew("route cut: start is not before the end")
+	}
+	if from > 0 || to < end {
+		tps = cutTrack(tps, dist, from, to)
+	}
+	if r.TurnAround > 0 {
+		dist = trackDist(tps)
+		if r.TurnAround < dist[len(dist)-1] {
+			tps = cutTrack(tps, dist, 0, r.TurnAround)
+		}
+		tps = roundTrip(tps)
+	}
+	if r.Laps > 1 {
+		var err error
+		if tps, err = repeatTrack(tps, r.Laps); err != nil {
+			return nil, err
+		}
+	}
+	return tps, nil
+}
+
+// trackDist returns the cumulative horizontal distances (m) of the track points.
+func trackDist(tps []gpx.Trkpt) []float64 {
+	dist := make([]float64, len(tps))
+	for i := 1; i < len(tps); i++ {
+		a, b := &tps[i-1], &tps[i]
+		lat := (a.Lat + b.Lat) / 2
+		dLon := (b.Lon - a.Lon) * metersLon(lat)
+		dLat := (b.Lat - a.Lat) * metersLat(lat)
+		dist[i] = dist[i-1] + math.Sqrt(dLon*dLon+dLat*dLat)
+	}
+	return dist
+}
+
+// cutTrack returns a copy of the track points from distance from to distance
+// to (m) with interpolated end points. 0 <= from < to <= dist[len(dist)-1].
+func cutTrack(tps []gpx.Trkpt, dist []float64, from, to float64) []gpx.Trkpt {
+	i := sort.SearchFloat64s(dist, from) // dist[i-1] < from <= dist[i]
+	j := sort.SearchFloat64s(dist, to)
+	q := make([]gpx.Trkpt, 0, j-i+2)
+	if i > 0 && dist[i] > from {
+		q = append(q, trkptAt(tps, dist, i, from))
+	}
+	q = append(q, tps[i:j]...)
+	return append(q, trkptAt(tps, dist, j, to))
+}
+
+// trkptAt returns the track point interpolated at distance d (m)
+// between the track points i-1 and i.
+func trkptAt(tps []gpx.Trkpt, dist []float64, i int, d float64) gpx.Trkpt {
+	if i == 0 {
+		return tps[0]
+	}
+	a, b := &tps[i-1], &tps[i]
+	t := (d - dist[i-1]) / (dist[i] - dist[i-1])
+	return gpx.Trkpt{
+		Lat: a.Lat + t*(b.Lat-a.Lat),
+		Lon: a.Lon + t*(b.Lon-a.Lon),
+		Ele: a.Ele + t*(b.Ele-a.Ele),
+	}
+}
+
+// repeatTrack returns the track points repeated n times. The track must be
+// a loop, the end within maxLapGap from the start. An open loop is closed
+// by the start point and the start point is not repeated.
+func repeatTrack(tps []gpx.Trkpt, n int) ([]gpx.Trkpt, error) {
+	const maxLapGap = 100.0 // m
+	first, last := tps[0], tps[len(tps)-1]
+	if first.Lat != last.Lat || first.Lon != last.Lon {
+		if gap := trackDist([]gpx.Trkpt{last, first})[1]; gap > maxLapGap {
+			return nil, errNew("laps: the route end is " + strconv.Itoa(int(gap)) +
+				" m from the start, not a loop")
+		}
+		tps = append(tps[:len(tps):len(tps)], first)
+	}
+	lap := tps[1:]
+	q := make([]gpx.Trkpt, 0, len(tps)+(n-1)*len(lap))
+	q = append(q, tps...)
+	for range n - 1 {
+		q = append(q, lap...)
+	}
+	return q, nil
+}
+
+// waypointTrkpt returns the index of the nearest track point of waypoint name.
+func waypointTrkpt(tps []gpx.Trkpt, wpts []gpx.Wpt, name string) (int, error) {
+	for _, w := range wpts {
+		if w.Name != name {
+			continue
+		}
+		var (
+			k       = -1
+			minDist = maxWaypointDist * maxWaypointDist
+			mLon    = metersLon(w.Lat)
+			mLat    = metersLat(w.Lat)
+		)
+		for i, t := range tps {
+			dLon := (t.Lon - w.Lon) * mLon
+			dLat := (t.Lat - w.Lat) * mLat
+			if d := dLon*dLon + dLat*dLat; d < minDist {
+				k, minDist = i, d
+			}
+		}
+		if k < 0 {
+			return 0, errNew("waypoint " + name + " is not on the route")
+		}
+		return k, nil
+	}
+	return 0, errNew("waypoint " + name + " not found")
+}
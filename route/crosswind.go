@@ -0,0 +1,68 @@
+package route
+
+import (
+	"math"
+
+	"github.com/pekkizen/motion"
+)
+
+/*
+A crosswind does not push the rider back, but it increases the apparent air
+speed va and turns the apparent wind by the yaw angle, which changes CdA.
+The drag of the apparent wind along the riding direction is
+
+	F = 0.5 * rho * CdA(yaw) * va^2 * cos(yaw),  va^2 = (v + w)^2 + x^2
+
+where v is the speed, w the head wind, x the crosswind component and
+yaw = atan2(|x|, v + w), over 90 degrees in a tailwind faster than the
+rider. The motion calculator uses F = 0.5 * rho * CdA * (v + w)^2, so a
+segment is given the effective CdA = CdA(yaw) * va^2 * |cos(yaw)| / (v + w)^2,
+evaluated at the segment target speed. Near the yaw angles of 90 degrees
+the drag goes to zero and the divisor is limited to va^2 / 4, the divisor
+at the yaw angles of 60 and 120 degrees.
+*/
+
+// yawDrag reports whether the drag depends on crosswinds.
+func yawDrag(p par) bool { return len(p.Bike.YawCdA) > 0 }
+
+// setCrosswindTargetVel sets the segment effective CdA and solves the target
+// speed again with it. The target speed time lost to the crosswind is added
+// to the route.
+func (s *segment) setCrosswindTargetVel(c *motion.BikeCalc, p par, power ratioGenerator, o *Route) error {
+	const rounds = 2
+	vTarget := s.vTarget
+	for i := 0; i < rounds; i++ {
+		s.cdA = s.crosswindCdA(s.vTarget, p)
+		c.SetCdA(s.cdA)
+		if e := s.setTargetVelAndPower(c, p, power); e != nil {
+			return e
+		}
+	}
+	o.timeCrosswind += s.dist/s.vTarget - s.dist/vTarget
+	return nil
+}
+
+// crosswindCdA returns the effective CdA of the segment at speed vel.
+func (s *segment) crosswindCdA(vel float64, p par) float64 {
+	var (
+		air  = vel + s.wind
+		va2  = air*air + s.windCross*s.windCross
+		yaw  = math.Atan2(math.Abs(s.windCross), air)
+		drag = p.Bike.CdA * yawRatio(p.Bike.YawCdA, yaw*(180/π)) * va2 * math.Abs(math.Cos(yaw))
+	)
+	return drag / max(air*air, va2/4)
+}
+
+// yawRatio interpolates the CdA ratio for yaw angle yaw (deg) from the table.
+// Outside the table the end values are used.
+func yawRatio(table [][2]float64, yaw float64) float64 {
+	if yaw <= table[0][0] {
+		return table[0][1]
+	}
+	for i := 1; i < len(table); i++ {
+		if y0, y1 := table[i-1], table[i]; yaw <= y1[0] {
+			return y0[1] + (yaw-y0[0])/(y1[0]-y0[0])*(y1[1]-y0[1])
+		}
+	}
+	return table[len(table)-1][1]
+}
@@ -0,0 +1,84 @@
+package route
+
+import (
+	"math"
+
+	"github.com/pekkizen/motion"
+)
+
+/*
+In a group ride the riders take turns at the front. The group rides at the
+speed of the front rider by the power model, and the followed rider is
+simulated at the front CdA in the pulls and at the draft CdA, a ratio k of
+the front CdA, in the sheltered parts. A sheltered pedaled road segment is
+ridden at the group target speed by the power of the target speed at the
+draft CdA, and the max and freewheeling speeds are by the draft CdA. One
+rotation of the followed rider is a pull at the front and a sheltered part
+of pull * (1/pullFraction - 1). The pulls are by riding time or by distance
+and a road segment is taken as a whole by its midpoint distance or by its
+arrival time. The pulls by time use the arrival times of the previous ride
+round. The flat ground
+power and speed calibration is by the solo front CdA.
+*/
+
+// groupRide reports whether the ride is a group ride.
+func groupRide(p par) bool { return p.Group.Size > 1 }
+
+// segmentCdA reports whether the road segments have their own CdA.
+func segmentCdA(p par) bool { return yawDrag(p) || groupRide(p) }
+
+// setPullPositions sets the road segments sheltered or at the front by the
+// midpoint position of the segment in the pull rotation.
+func (o *Route) setPullPositions(p par) {
+	var (
+		g    = &p.Group
+		pull = g.PullDist
+		dist float64
+	)
+	if g.PullTime > 0 {
+		pull = g.PullTime
+	}
+	cycle := pull / g.PullFraction
+
+	for i := 1; i <= o.segments; i++ {
+		s := &o.route[i]
+		pos := dist + s.dist/2
+		if g.PullTime > 0 {
+			pos = s.timeArrival
+		}
+		dist += s.dist
+		s.sheltered = math.Mod(pos, cycle) >= pull
+	}
+}
+
+// setDraftTarget sets the draft CdA of a sheltered segment and the target
+// power for the group target speed at it.
+func (s *segment) setDraftTarget(c *motion.BikeCalc, p par) {
+	s.cdA *= p.Group.DraftCdA
+	c.SetCdA(s.cdA)
+	if s.powerTarget <= 0 {
+		return
+	}
+	power := max(c.PowerFromVel(s.vTarget), powerTol)
+	s.powerRiderTarget *= power / s.powerTarget
+	s.powerTarget = power
+}
+
+// addGroupRide adds the front and sheltered position energies, times and
+// distances of the followed rider.
+func (r *Results) addGroupRide(o *Route, p par) {
+	for i := 1; i <= o.segments; i++ {
+		s := &o.route[i]
+		if !s.sheltered {
+			r.JriderFront += s.jouleRider
+			r.TimeFront += s.time
+			r.DistFront += s.dist
+			continue
+		}
+		r.JriderDraft += s.jouleRider
+		r.TimeDraft += s.time
+		r.DistDraft += s.dist
+	}
+	r.JriderFront *= p.PowerOut
+	r.JriderDraft *= p.PowerOut
+}
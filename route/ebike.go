@@ -0,0 +1,99 @@
+package route
+
+import "github.com/pekkizen/motion"
+
+/*
+E-bike motor assist. The motor adds assist x rider power, at most the max
+motor power, below the assist cutoff speed. The target power of a road
+segment is the rider and the motor power together: the assisted power if
+its speed is below the cutoff speed, the rider power if the rider alone is
+faster than the cutoff speed and otherwise the power of the cutoff speed.
+The ride calculation splits the propulsion power of each calculation step
+to the rider and the motor energies by the step speed. All the motor power
+values are at the wheel. The battery energy is the motor energy by the
+motor efficiency. The assist is not cut with an empty battery, but the
+distance the battery runs out is reported.
+
+Regenerative braking recovers the regen fraction of the braking energy of
+a road segment at most by the max regen power over the braking time. The
+recovered energy is taken from the braking energy and charged to the
+battery by the motor efficiency. With the regen descent speed the
+descents freewheeling faster than the speed are braked to it, and the
+braking is regenerated as above. False flats are not braked.
+*/
+
+// ebike reports whether the bike has motor assist.
+func ebike(p par) bool { return p.Ebike.Assist > 0 }
+
+// regen reports whether the braking energy is regenerated.
+func regen(p par) bool { return ebike(p) && p.Ebike.Regen > 0 }
+
+// regenDescent reports whether the descents are held at the regen speed.
+func regenDescent(p par) bool { return ebike(p) && p.Ebike.RegenSpeed > 0 }
+
+// assistedPower returns the rider and the motor power of the rider power.
+func assistedPower(c *motion.BikeCalc, p par, rider float64) float64 {
+	q := &p.Ebike
+	if rider <= 0 {
+		return rider
+	}
+	total := rider + min(q.Assist*rider, q.MaxPower)
+	if vel, ok := c.VelFromPower(total, -1); !ok || vel <= q.CutoffSpeed {
+		return total
+	}
+	if vel, ok := c.VelFromPower(rider, -1); ok && vel >= q.CutoffSpeed {
+		return rider
+	}
+	return c.PowerFromVel(q.CutoffSpeed)
+}
+
+// motorPower returns the motor part of the propulsion power at speed vel.
+// At the cutoff speed the motor gives only the power over the rider target
+// power.
+func (s *segment) motorPower(p par, power, vel float64) float64 {
+	q := &p.Ebike
+	if q.Assist <= 0 || power <= 0 || vel > q.CutoffSpeed+sameVelTol {
+		return 0
+	}
+	motor := min(power*q.Assist/(1+q.Assist), q.MaxPower)
+	if vel >= q.CutoffSpeed-sameVelTol {
+		motor = min(motor, max(0, power-s.powerRiderTarget))
+	}
+	return motor
+}
+
+// addEbike adds the motor and battery energies, the remaining battery and
+// range and the distance the battery runs out.
+func (r *Results) addEbike(o *Route, p par) {
+	var (
+		q    = &p.Ebike
+		dist float64
+	)
+	r.BatteryEmptyAt = -1
+	for i := 1; i <= o.segments; i++ {
+		s := &o.route[i]
+		r.JbatteryUsed += s.jouleMotor/q.Efficiency - s.jouleRegen*q.Efficiency
+		dist += s.dist
+		if r.BatteryEmptyAt < 0 && r.JbatteryUsed > q.Battery {
+			r.BatteryEmptyAt = dist
+		}
+	}
+	r.JbatteryLeft = max(0, q.Battery-r.JbatteryUsed)
+	r.BatteryUsedPros = 100 * r.JbatteryUsed / q.Battery
+	if r.JbatteryUsed > 0 {
+		r.RangeLeft = r.JbatteryLeft / r.JbatteryUsed * dist
+	}
+}
+
+// addRegen sets the regenerated energy of segment s and moves it from the
+// braking to the regeneration energy.
+func (r *Results) addRegen(s *segment, p par) {
+	q := &p.Ebike
+	if s.timeBrake <= 0 || s.jouleBrake >= 0 {
+		return
+	}
+	power := min(-s.jouleBrake/s.timeBrake*q.Regen, q.MaxRegenPower)
+	s.jouleRegen = power * s.timeBrake // seg s updated here
+	r.Jbraking += s.jouleRegen
+	r.Jregen -= s.jouleRegen
+}
@@ -0,0 +1,92 @@
+package route
+
+import (
+	"math"
+
+	"github.com/pekkizen/motion"
+)
+
+/*
+Fatigue by the critical power CP and the W' balance model of Skiba et al.
+2012, Modeling the expenditure and reconstitution of work capacity above
+critical power, in the differential form of Skiba et al. 2015:
+
+	P > CP: dW'bal/dt = -(P - CP)
+	P < CP: dW'bal/dt = (W' - W'bal) (CP - P) / W'
+
+CP and W' are scaled by the drivetrain efficiency as the rider powers are.
+The W' balance at the segment arrivals is calculated from the rider power of
+the previous ride round. Where the balance is below the cap balance, the
+target power is capped to CP. The endurance decay decreases the target power
+and CP linearly by the ride time. The ride is iterated until the ride time
+converges. The capping may switch on and off between the rounds, and then
+the ride time does not converge.
+*/
+
+// fatigue reports whether the rider fatigue is modeled.
+func fatigue(p par) bool { return p.Fatigue.CP > 0 }
+
+// enduranceFactor returns the power factor of the endurance decay at time t (s).
+func enduranceFactor(p par, t float64) float64 {
+	return max(0.5, 1-p.Fatigue.EnduranceDecay*t*s2h)
+}
+
+// wBalance returns the W' balance after time dt (s) at power (w), when the
+// balance was wBal at the start and cp is the critical power.
+func wBalance(wBal, power, cp, wPrime, dt float64) float64 {
+	if power > cp {
+		return wBal - (power-cp)*dt
+	}
+	return wPrime - (wPrime-wBal)*math.Exp(-(cp-power)*dt/wPrime)
+}
+
+// setWBalance sets the W' balance at the segment arrivals from the ride.
+// The rest stop and the uphill break are at the segment start and the freewheeling and
+// braking time is at zero power. The W' balance of the route end
+// and its minimum are set to the route.
+func (o *Route) setWBalance(p par) {
+	var (
+		q    = &p.Fatigue
+		wBal = q.WPrime
+	)
+	o.wBalMin = wBal
+	for i := 1; i <= o.segments; i++ {
+		s := &o.route[i]
+		cp := q.CP * enduranceFactor(p, s.timeArrival)
+		s.wBal = wBal
+		wBal = wBalance(wBal, 0, cp, q.WPrime, s.timeStop+s.timeBreak)
+		wBal = wBalance(wBal, s.powerRider, cp, q.WPrime, s.timeRider)
+		o.wBalMin = min(o.wBalMin, wBal)
+		wBal = wBalance(wBal, 0, cp, q.WPrime, s.time-s.timeRider)
+	}
+	o.wBalEnd = wBal
+}
+
+// setFatigueTargetVel scales the target power by the endurance decay and
+// caps it to CP, if the W' balance at the segment arrival is below the cap
+// balance. The target speed time lost to fatigue is added to the route.
+func (s *segment) setFatigueTargetVel(c *motion.BikeCalc, p par, power ratioGenerator, o *Route) error {
+	var (
+		q       = &p.Fatigue
+		decay   = enduranceFactor(p, s.timeArrival)
+		vTarget = s.vTarget
+	)
+	if s.powerTarget <= 0 {
+		return nil
+	}
+	if decay < 1 {
+		s.powerFactor *= decay
+		if e := s.setTargetVelAndPower(c, p, power); e != nil {
+			return e
+		}
+	}
+	if cp := q.CP * decay; s.wBal < q.CapBalance*q.WPrime && s.powerTarget > cp {
+		vel, ok := c.VelFromPower(cp, s.vTarget)
+		if !ok {
+			return errNew(" setFatigueTargetVel: velocity is not solvable: " + c.Error())
+		}
+		s.powerTarget, s.vTarget = cp, vel
+	}
+	o.timeFatigue += s.dist/s.vTarget - s.dist/vTarget
+	return nil
+}
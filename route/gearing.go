@@ -0,0 +1,174 @@
+package route
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strconv"
+
+	"github.com/pekkizen/motion"
+)
+
+/*
+Gearing by the chainrings, the cassette, the wheel circumference and the
+cadence range. The top gear at the max cadence gives the max pedaled speed,
+if it is lower than the given one, and the lowest gear at the min cadence
+the lowest speed the rider can turn the pedals. The target speed of a
+pedaled segment is at least this speed, at the power the speed needs, and
+a pedaled segment ridden slower, e.g. accelerating from a stop, is flagged
+as undergeared. The gear of a pedaled segment is the gear with the cadence
+nearest to the middle of the cadence range.
+
+The climbing table has by grade the min sustainable speed, the lowest gear
+speed or minSpeed, and the power it needs, and the speed at the uphill
+power. A grade is sustainable if the uphill power speed is not below the
+min speed. The table goes by climbGradeStep up to the first grade that is
+not sustainable.
+*/
+
+const (
+	climbGradeStep = 0.02
+	climbGradeMax  = 0.40
+)
+
+// ClimbSpeed is a grade of the gearing climbing table.
+type ClimbSpeed struct {
+	Grade    float64 // %
+	MinSpeed float64 // km/h, min sustainable speed
+	Power    float64 // W at MinSpeed
+	MaxSpeed float64 // km/h at the uphill power
+}
+
+// gear is a chainring and cassette sprocket combination.
+type gear struct {
+	front, rear int     // teeth
+	ratio       float64 // development (m) per crank revolution
+}
+
+type drivetrain struct {
+	gears      []gear // by increasing ratio
+	minCadence float64
+	maxCadence float64
+}
+
+// gearing reports whether the drivetrain gearing is given.
+func gearing(p par) bool {
+	q := &p.Gearing
+	return len(q.Chainrings) > 0 && len(q.Cassette) > 0
+}
+
+// newDrivetrain returns the drivetrain of the gearing parameters, or nil.
+func newDrivetrain(p par) *drivetrain {
+	if !gearing(p) {
+		return nil
+	}
+	q := &p.Gearing
+	d := &drivetrain{minCadence: q.MinCadence, maxCadence: q.MaxCadence}
+	for _, f := range q.Chainrings {
+		for _, r := range q.Cassette {
+			d.gears = append(d.gears, gear{
+				front: int(f),
+				rear:  int(r),
+				ratio: f / r * q.WheelCircumference,
+			})
+		}
+	}
+	slices.SortFunc(d.gears, func(a, b gear) int { return cmp.Compare(a.ratio, b.ratio) })
+	return d
+}
+
+// GearSpeedRange returns the speeds (m/s) of the lowest gear at the min
+// cadence and the top gear at the max cadence. Both are 0 without gearing.
+func GearSpeedRange(p par) (low, high float64) {
+	d := newDrivetrain(p)
+	if d == nil {
+		return 0, 0
+	}
+	return d.gears[0].ratio * d.minCadence, d.gears[len(d.gears)-1].ratio * d.maxCadence
+}
+
+// gear returns the gear and the cadence (1/s) at speed vel. ok is false if
+// vel is below the speed of the lowest gear at the min cadence.
+func (d *drivetrain) gear(vel float64) (g gear, cadence float64, ok bool) {
+	mid := (d.minCadence + d.maxCadence) / 2
+	g = d.gears[0]
+	for _, x := range d.gears {
+		if math.Abs(vel/x.ratio-mid) < math.Abs(vel/g.ratio-mid) {
+			g = x
+		}
+	}
+	cadence = vel / g.ratio
+	return g, cadence, cadence >= d.minCadence
+}
+
+// segmentGear returns the gear and the cadence (1/s) of the pedaled part of
+// segment s. pedaled is false for the segments without pedaling.
+func (d *drivetrain) segmentGear(s *segment) (g gear, cadence float64, pedaled, ok bool) {
+	if s.timeRider <= 0 || s.distRider <= 0 {
+		return gear{}, 0, false, true
+	}
+	g, cadence, ok = d.gear(s.distRider / s.timeRider)
+	return g, cadence, true, ok
+}
+
+// addGearing adds the gear speed range, the max grade of the lowest gear at
+// the uphill power and the undergeared segments.
+func (r *Results) addGearing(o *Route, c *motion.BikeCalc, p par) {
+	d := o.drivetrain
+	low, high := GearSpeedRange(p)
+	r.GearLowSpeed = low * ms2kmh
+	r.GearTopSpeed = high * ms2kmh
+	c.SetWind(0)
+	r.MaxGradeLowGear = c.GradeFromVelAndPower(low, p.Powermodel.UphillPower) * 100
+	r.addClimbSpeeds(o, c, p)
+	for i := 1; i <= o.segments; i++ {
+		s := &o.route[i]
+		if _, _, pedaled, ok := d.segmentGear(s); pedaled && !ok {
+			r.SegmentsUndergeared++
+			r.DistUndergeared += s.dist
+		}
+	}
+}
+
+// addClimbSpeeds adds the gearing climbing table.
+func (r *Results) addClimbSpeeds(o *Route, c *motion.BikeCalc, p par) {
+	var (
+		vMin   = o.minRideVel(p)
+		uphill = p.Powermodel.UphillPower
+	)
+	for grade := climbGradeStep; grade < climbGradeMax+1e-9; grade += climbGradeStep {
+		c.SetGrade(grade)
+		power := c.PowerFromVel(vMin)
+		vel, _ := c.VelFromPower(uphill, -1)
+		r.ClimbSpeeds = append(r.ClimbSpeeds, ClimbSpeed{
+			Grade:    grade * 100,
+			MinSpeed: vMin * ms2kmh,
+			Power:    power * p.PowerOut,
+			MaxSpeed: vel * ms2kmh,
+		})
+		if power > uphill {
+			break
+		}
+	}
+}
+
+// appendGear appends the gear, e.g. 34x28, the cadence (rpm) and the
+// undergeared flag 1 of segment s. The gear and the cadence are empty for
+// the segments without pedaling.
+func appendGear(b []byte, d *drivetrain, s *segment, sep byte) []byte {
+	g, cadence, pedaled, ok := d.segmentGear(s)
+	if pedaled {
+		b = strconv.AppendInt(b, int64(g.front), 10)
+		b = append(b, 'x')
+		b = strconv.AppendInt(b, int64(g.rear), 10)
+	}
+	b = append(b, sep)
+	if pedaled {
+		b = strconv.AppendFloat(b, cadence*60, 'f', 0, 64)
+	}
+	b = append(b, sep)
+	if !ok {
+		b = append(b, '1')
+	}
+	return append(b, sep)
+}
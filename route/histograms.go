@@ -0,0 +1,121 @@
+package route
+
+import "sort"
+
+/*
+Histograms of the ride time, distance and rider energy by rider power zone,
+speed band and grade band. The power zones and the speed bands are
+accumulated by the ride calculation steps: a pedaled step is in the zone of
+its rider power and every step is in the band of its mean speed. Walking is
+at the walking speed. The grade bands are by the road segment grades. The
+bin limits are the lower limits of the bins from the second bin: limits
+[10, 20] give the bins < 10, 10-20 and >= 20.
+*/
+
+// Histogram is the time (h), distance (km) and rider energy (Wh) by bin.
+// Limits are in %FTP, km/h or %.
+type Histogram struct {
+	Limits []float64
+	Time   []float64
+	Dist   []float64
+	Energy []float64
+}
+
+// histograms reports whether any histogram is made.
+func histograms(p par) bool {
+	q := &p.Histograms
+	return q.FTP > 0 || len(q.SpeedBands) > 0 || len(q.GradeBands) > 0
+}
+
+func newHistogram(limits []float64, scale float64) *Histogram {
+	n := len(limits) + 1
+	h := &Histogram{
+		Limits: make([]float64, len(limits)),
+		Time:   make([]float64, n),
+		Dist:   make([]float64, n),
+		Energy: make([]float64, n),
+	}
+	for i, x := range limits {
+		h.Limits[i] = x * scale
+	}
+	return h
+}
+
+// stepBins are the power zone and speed band histograms of the ride
+// calculation steps. A nil *stepBins adds nothing.
+type stepBins struct {
+	ftp   float64
+	power *Histogram
+	speed *Histogram
+}
+
+// newStepBins returns the step histograms of the ride, or nil.
+func newStepBins(p par) *stepBins {
+	q := &p.Histograms
+	if q.FTP <= 0 && len(q.SpeedBands) == 0 {
+		return nil
+	}
+	b := &stepBins{ftp: q.FTP}
+	if q.FTP > 0 {
+		b.power = newHistogram(q.PowerZones, 100)
+	}
+	if len(q.SpeedBands) > 0 {
+		b.speed = newHistogram(q.SpeedBands, ms2kmh)
+	}
+	return b
+}
+
+// addStep adds a calculation step of mean speed vel, time, distance and
+// rider power.
+func (b *stepBins) addStep(vel, time, dist, power float64) {
+	if b == nil || time <= 0 {
+		return
+	}
+	joule := max(power, 0) * time
+	if b.speed != nil {
+		b.speed.add(vel*ms2kmh, time, dist, joule)
+	}
+	if b.power != nil && power > 0 {
+		b.power.add(100*power/b.ftp, time, dist, joule)
+	}
+}
+
+// add adds time, dist and joule to the bin of x.
+func (h *Histogram) add(x, time, dist, joule float64) {
+	i := sort.Search(len(h.Limits), func(i int) bool { return h.Limits[i] > x })
+	h.Time[i] += time
+	h.Dist[i] += dist
+	h.Energy[i] += joule
+}
+
+func (h *Histogram) unitConversionOut(powerOut float64) {
+	if h == nil {
+		return
+	}
+	for i := range h.Time {
+		h.Time[i] *= s2h
+		h.Dist[i] *= m2km
+		h.Energy[i] *= j2Wh * powerOut
+	}
+}
+
+// addHistograms adds the power zone and speed band histograms of the ride
+// steps and the grade band histogram.
+func (r *Results) addHistograms(o *Route, p par) {
+	if b := o.bins; b != nil {
+		r.PowerZones = b.power
+		r.SpeedBands = b.speed
+	}
+	if q := &p.Histograms; len(q.GradeBands) > 0 {
+		r.GradeBands = newHistogram(q.GradeBands, 100)
+		for i := 1; i <= o.segments; i++ {
+			s := &o.route[i]
+			if s.time > 0 {
+				r.GradeBands.add(s.grade*100, s.time, s.dist, s.jouleRider)
+			}
+		}
+	}
+	r.PowerZones.unitConversionOut(p.PowerOut)
+	r.SpeedBands.unitConversionOut(p.PowerOut)
+	r.GradeBands.unitConversionOut(p.PowerOut)
+}
@@ -0,0 +1,156 @@
+package route
+
+import (
+	"math"
+
+	"github.com/pekkizen/motion"
+)
+
+/*
+Some ride setups depend on the time of the day. With a wind forecast the wind
+of a road segment is the wind at the time the rider arrives at the segment.
+The arrival times are known only after the ride is calculated, and they depend
+on the wind. RideIterated calculates the ride repeatedly with the arrival times
+of the previous round, until the ride time converges. The first round uses
+arrival times estimated from the flat ground speed.
+*/
+
+// SetWindForecast sets a time varying wind for the route.
+func (o *Route) SetWindForecast(w windForecaster) { o.windForecast = w }
+
+// timeDependent reports whether the ride setup depends on the arrival times.
+func (o *Route) timeDependent(p par) bool {
+	return o.windForecast != nil || o.temperatureByTime(p) || fatigue(p) || restStops(p) ||
+		groupRide(p) && p.Group.PullTime > 0
+}
+
+// RideIterated calculates the ride by SetupRide, Ride and UphillBreaks. If the
+// ride setup depends on the arrival times, the calculation is repeated until
+// the ride time changes less than a second, at most maxRounds times.
+// Converged reports whether the ride time converged.
+func (o *Route) RideIterated(c *motion.BikeCalc, power ratioGenerator, p par) error {
+	const (
+		maxRounds = 12
+		timeTol   = 1.0 // s
+	)
+	prevTime := -1.0
+	if o.timeDependent(p) {
+		o.estimateArrivalTimes(p)
+		o.setupTimeDependent(p)
+	}
+	if fatigue(p) {
+		o.setWBalance(p) // full W' before the first ride
+	}
+	for o.rounds = 1; ; o.rounds++ {
+		if segmentRho(p) {
+			o.setAirDensity(c, p)
+		}
+		if err := o.SetupRide(c, power, p); err != nil {
+			return err
+		}
+		o.Ride(c, p)
+		o.UphillBreaks(p)
+		o.setArrivalTimes()
+		if fatigue(p) {
+			o.setWBalance(p)
+		}
+
+		if !o.timeDependent(p) {
+			o.converged = true
+			return nil
+		}
+		if o.converged = math.Abs(o.Time-prevTime) < timeTol; o.converged || o.rounds == maxRounds {
+			return nil
+		}
+		prevTime = o.Time
+		o.setupTimeDependent(p)
+		o.clearRide()
+	}
+}
+
+// Converged reports whether the ride time of RideIterated converged. The
+// W' balance capping of the fatigue model may oscillate between the rounds.
+func (o *Route) Converged() bool { return o.converged }
+
+// estimateArrivalTimes sets arrival times from the flat ground speed.
+func (o *Route) estimateArrivalTimes(p par) {
+	var (
+		time float64
+		vel  = p.Powermodel.FlatSpeed
+	)
+	for i := 1; i <= o.segments; i++ {
+		s := &o.route[i]
+		s.timeArrival = time
+		time += s.dist / vel
+	}
+}
+
+// setArrivalTimes sets the arrival times of the calculated ride.
+// The rest stop and the uphill break of a segment are taken at the start
+// of the segment.
+func (o *Route) setArrivalTimes() {
+	var time float64
+	for i := 1; i <= o.segments; i++ {
+		s := &o.route[i]
+		s.timeArrival = time
+		time += s.timeStop + s.timeBreak + s.time
+	}
+}
+
+func (o *Route) setupTimeDependent(p par) {
+	if restStops(p) {
+		o.setRestStops(p)
+	}
+	if o.windForecast != nil {
+		o.windFromForecast()
+	}
+}
+
+// windFromForecast sets the wind of the road segments from the wind forecast
+// at the arrival times.
+func (o *Route) windFromForecast() {
+	for i := 1; i <= o.segments; i++ {
+		s := &o.route[i]
+		course, speed := o.windForecast.Wind(s.timeArrival)
+		sinW, cosW := math.Sincos(course * (π / 180))
+		sinC, cosC := math.Sincos(s.course)
+		speed *= s.windProfile
+		s.wind = speed * (sinC*sinW + cosC*cosW)
+		s.windCross = speed * (cosC*sinW - sinC*cosW)
+	}
+}
+
+// clearRide clears the ride calculation results of the road segments and
+// the route. Road data, arrival times, rest stops and W' balances are kept.
+func (o *Route) clearRide() {
+	for i := range o.route {
+		s := &o.route[i]
+		*s = segment{
+			segnum:      s.segnum,
+			lon:         s.lon,
+			lat:         s.lat,
+			ele:         s.ele,
+			eleGPX:      s.eleGPX,
+			grade:       s.grade,
+			dist:        s.dist,
+			distHor:     s.distHor,
+			course:      s.course,
+			radius:      s.radius,
+			wind:        s.wind,
+			windCross:   s.windCross,
+			windProfile: s.windProfile,
+			timeArrival: s.timeArrival,
+			timeStop:    s.timeStop,
+			mealStop:    s.mealStop,
+			wBal:        s.wBal,
+		}
+	}
+	o.JouleRider = 0
+	o.JriderTarget = 0
+	o.Time = 0
+	o.TimeTarget = 0
+	o.timeCrosswind = 0
+	o.timeRho = 0
+	o.timeAltitude = 0
+	o.timeFatigue = 0
+}
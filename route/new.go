@@ -2,6 +2,7 @@ package route
 
 import (
 	"math"
+	"slices"
 
 	"github.com/pekkizen/bikeride/gpx"
 )
@@ -10,6 +11,12 @@ import (
 func New(gpx *gpx.GPX, p par) (*Route, error) {
 
 	tps := gpx.TrkpSlice()
+	if composed(p) && len(tps) > 1 {
+		var err error
+		if tps, err = compose(tps, gpx.Wpts, p); err != nil {
+			return nil, err
+		}
+	}
 	points := len(tps)
 	if p.Ride.RoundTrip {
 		points *= 2
@@ -51,10 +58,11 @@ func New(gpx *gpx.GPX, p par) (*Route, error) {
 		tps = roundTrip(tps)
 
 	} else if p.Ride.ReverseRoute {
-		tps = gpx.TrkpSliceCopy() //don't change the original
+		tps = slices.Clone(tps) // compose may return the original
 		reverseTrack(tps)
 	}
 	o.importTrackPoints(tps)
+	o.setWaypoints(gpx.Wpts)
 	return o, nil
 }
 
@@ -93,6 +101,7 @@ func (o *Route) importTrackPoints(tps []gpx.Trkpt) {
 	var (
 		distMean, dist   float64
 		eleMean, latMean float64
+		lonMean          float64
 		seg              = 0
 		s                *segment
 		minDist          = max(o.filter.minSegDist, minMinDist)
@@ -117,11 +126,13 @@ func (o *Route) importTrackPoints(tps []gpx.Trkpt) {
 		s.eleGPX = p.Ele
 		eleMean += p.Ele
 		latMean += p.Lat
+		lonMean += p.Lon
 		distMean += dist
 	}
 	o.segments = seg - 1
 	o.EleMean = eleMean / float64(seg)
 	o.LatMean = latMean / float64(seg)
+	o.lonMean = lonMean / float64(seg)
 	o.distMean = distMean / float64(seg) // horisontal, not final, for median calc.
 	o.route = o.route[: seg+1 : seg+1]   // clip excess capacity, do not remove/change because
 	//                                   // len(o.route)-2 == o.segments is used later
@@ -7,7 +7,7 @@ func (s *segment) acceDeceVel(c *motion.BikeCalc, p par) {
 		vel      = s.vExit //***
 		distLeft = s.distLeft
 	)
-	var timeRider, jouleDrag, jouleRider, jouleDragRider,
+	var timeRider, jouleDrag, jouleRider, jouleMotor, jouleDragRider,
 		distRider, dist, time float64
 
 	steps, Δvel := velSteps(vel, s.vTarget, p.OdeltaVel)
@@ -42,12 +42,16 @@ func (s *segment) acceDeceVel(c *motion.BikeCalc, p par) {
 		vel += Δvel
 		time += Δtime
 		jouleDrag -= Δjdrag
+		var motor float64
 		if power > 0 {
+			motor = s.motorPower(p, power, vel)
 			timeRider += Δtime
-			jouleRider += Δtime * power
+			jouleRider += Δtime * (power - motor)
+			jouleMotor += Δtime * motor
 			jouleDragRider -= Δjdrag
 			distRider += Δdist
 		}
+		s.bins.addStep(vel-Δvel/2, Δtime, Δdist, power-motor)
 	}
 	if steps == 0 { // vTarget reached, take exact vel
 		vel = s.vTarget
@@ -59,6 +63,7 @@ func (s *segment) acceDeceVel(c *motion.BikeCalc, p par) {
 	s.distRider += distRider
 	s.timeRider += timeRider
 	s.jouleRider += jouleRider
+	s.jouleMotor += jouleMotor
 	s.jouleDragRider += jouleDragRider
 
 	if distLeft -= dist; distLeft < distTol {
@@ -117,9 +122,12 @@ func (s *segment) acceDeceDist(c *motion.BikeCalc, p par) {
 		time += Δtime
 		dist += Δdist
 		s.jouleDrag -= Δjdrag
+		var motor float64
 		if power > 0 {
+			motor = s.motorPower(p, power, vel)
 			s.timeRider += Δtime
-			s.jouleRider += Δtime * power
+			s.jouleRider += Δtime * (power - motor)
+			s.jouleMotor += Δtime * motor
 			s.jouleDragRider -= Δjdrag
 			s.distRider += Δdist
 		} else {
@@ -127,6 +135,7 @@ func (s *segment) acceDeceDist(c *motion.BikeCalc, p par) {
 			s.distFreewheel += Δdist
 			s.jouleDragFreewh -= Δjdrag
 		}
+		s.bins.addStep(vel-Δvel/2, Δtime, Δdist, power-motor)
 	}
 	s.vExit = vel
 	s.time += time
@@ -195,9 +204,12 @@ func (s *segment) acceDeceTime(c *motion.BikeCalc, p par) {
 		}
 		time += Δtime
 		s.jouleDrag -= Δjdrag
+		var motor float64
 		if power > 0 {
+			motor = s.motorPower(p, power, vel)
 			s.timeRider += Δtime
-			s.jouleRider += Δtime * power
+			s.jouleRider += Δtime * (power - motor)
+			s.jouleMotor += Δtime * motor
 			s.jouleDragRider -= Δjdrag
 			s.distRider += Δdist
 		} else {
@@ -205,6 +217,7 @@ func (s *segment) acceDeceTime(c *motion.BikeCalc, p par) {
 			s.distFreewheel += Δdist
 			s.jouleDragFreewh -= Δjdrag
 		}
+		s.bins.addStep(vel-Δvel/2, Δtime, Δdist, power-motor)
 	}
 	s.vExit = vel
 	s.time += time
@@ -20,7 +20,7 @@ func (s *segment) brake(c *motion.BikeCalc, p par, v0, v1 float64) {
 
 		if Δtime < 0 {
 			s.appendPath(noAcceleration)
-			s.rideConstantVel(c) //??
+			s.rideConstantVel(c, p) //??
 			return
 		}
 		s.calcSteps++
@@ -30,12 +30,14 @@ func (s *segment) brake(c *motion.BikeCalc, p par, v0, v1 float64) {
 			Δvel *= ipo
 			Δtime *= ipo
 			Δdrag *= ipo
+			Δdist *= ipo
 			dist = distLeft
 			steps = -1
 		}
 		time += Δtime
 		jouleDrag -= Δdrag
 		vel += Δvel
+		s.bins.addStep(vel-Δvel/2, Δtime, Δdist, 0)
 	}
 	if steps == 0 {
 		vel = v1
@@ -47,19 +47,23 @@ func (s *segment) acceDecePower(p par, acce bool) (maxPedaled, power float64) {
 }
 
 func (s *segment) accelerationPower(p par) (power float64) {
-	q := &p.Ride
+	var (
+		q        = &p.Ride
+		minPower = q.PowerAcceMin * s.powerFactor
+		maxPower = p.Powermodel.UphillPower * s.powerFactor
+	)
 	if s.powerTarget < 0 {
-		if s.powerTarget < -2*q.PowerAcceMin {
+		if s.powerTarget < -2*minPower {
 			return 0
 		}
-		return q.PowerAcceMin
+		return minPower
 	}
 	power = q.PowerAcce * s.powerTarget
-	if power < q.PowerAcceMin {
-		return q.PowerAcceMin
+	if power < minPower {
+		return minPower
 	}
-	if power > p.Powermodel.UphillPower {
-		return max(p.Powermodel.UphillPower, 1.025*s.powerTarget)
+	if power > maxPower {
+		return max(maxPower, 1.025*s.powerTarget)
 	}
 	return
 }
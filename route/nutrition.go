@@ -0,0 +1,119 @@
+package route
+
+import "math"
+
+/*
+The nutrition plan has a feed every feedInterval of ride time, uphill
+breaks included. A feed is at the end of the road segment where the interval
+is full, or at the nearest waypoint, e.g. a café, within the waypoint snap
+distance. The carbohydrates of a feed are carbsPerHour for the interval and
+the fluid is the sweat loss since the previous feed.
+
+Without a given sweat rate the sweat loss is estimated by the metabolic heat.
+The heat is the rider energy / humanEfficiency - rider energy plus the resting
+metabolic heat. The share of the heat evaporated by sweating is (T - 5) / 30,
+between 0.2 and 1, by the temperature T (C) and the latent heat of sweat
+evaporation is 2430 kJ/l.
+*/
+
+const (
+	restHeat   = 80.0   // W
+	sweatHeat  = 2.43e6 // J/l
+	feedTimeOK = 0.5    // share of feed interval, a waypoint feed not earlier
+)
+
+// Feed is a nutrition plan feed on the route.
+type Feed struct {
+	Dist     float64 // km
+	Time     float64 // h from the start, breaks included
+	Carbs    float64 // g
+	Fluid    float64 // l
+	Waypoint string
+}
+
+// FoodAmount is the amount of an energy equivalent food of the rider energy.
+type FoodAmount struct {
+	Name   string
+	Unit   string
+	Amount float64
+}
+
+// nutrition reports whether the nutrition plan is made.
+func nutrition(p par) bool { return p.Nutrition.FeedInterval > 0 }
+
+// addFoods adds the energy equivalent foods of the rider and the walking
+// energy (J).
+func (r *Results) addFoods(p par) {
+	for _, f := range p.Nutrition.Foods {
+		r.Foods = append(r.Foods, FoodAmount{
+			Name:   f.Name,
+			Unit:   f.Unit,
+			Amount: (r.JriderTotal + r.JriderWalk) / (humanEfficiency * f.Energy),
+		})
+	}
+}
+
+// sweatLoss returns the sweat loss (l) of road segment s.
+func (s *segment) sweatLoss(p par) float64 {
+	time := s.time + s.timeBreak + s.timeStop
+	if p.Nutrition.SweatRate >= 0 {
+		return p.Nutrition.SweatRate * time * s2h
+	}
+	temp := p.Environment.Temperature
+	if segmentRho(p) {
+		temp = s.temperature
+	}
+	share := min(max((temp-5)/30, 0.2), 1)
+	heat := s.jouleRider*p.PowerOut*(1/humanEfficiency-1) + restHeat*time
+	return share * heat / sweatHeat
+}
+
+// addNutrition adds the nutrition plan. The waypoint arrival times must be
+// added before.
+func (r *Results) addNutrition(o *Route, p par) {
+	var (
+		n        = &p.Nutrition
+		interval = n.FeedInterval
+		next     = interval
+		fluid    float64
+		dist     float64
+		prevFeed float64
+	)
+	for i := 1; i <= o.segments; i++ {
+		s := &o.route[i]
+		loss := s.sweatLoss(p)
+		r.Fluid += loss
+		fluid += loss
+		dist += s.dist
+		time := s.rideStart() + s.time
+		if time < next || i == o.segments {
+			continue
+		}
+		f := Feed{Dist: dist * m2km, Time: time * s2h}
+		if w := r.nearestWaypoint(f.Dist, n.WaypointSnap*m2km); w != nil &&
+			w.Time*3600 > prevFeed+feedTimeOK*interval {
+			f.Dist, f.Time, f.Waypoint = w.Dist, w.Time, w.Name
+		}
+		f.Carbs = n.CarbsPerHour * (f.Time - prevFeed*s2h)
+		f.Fluid = fluid
+		r.Feeds = append(r.Feeds, f)
+		prevFeed = f.Time * 3600
+		next = prevFeed + interval
+		fluid = 0
+	}
+	r.Carbs = n.CarbsPerHour * o.finishTime() * s2h
+	r.CarriedLoad = n.CarriedFood + n.CarriedWater
+	r.WaterResupply = max(0, r.Fluid-n.CarriedWater)
+}
+
+// nearestWaypoint returns the nearest waypoint within distance snap (km)
+// of route distance dist (km) or nil.
+func (r *Results) nearestWaypoint(dist, snap float64) *Waypoint {
+	var w *Waypoint
+	for i := range r.Waypoints {
+		if d := math.Abs(r.Waypoints[i].Dist - dist); d <= snap {
+			w, snap = &r.Waypoints[i], d
+		}
+	}
+	return w
+}
@@ -0,0 +1,177 @@
+package route
+
+import (
+	"math"
+
+	"github.com/pekkizen/motion"
+)
+
+/*
+Rest stops are at the road segment starts. A stop is due when the elapsed
+time from the end of the previous stop is everyTime, when the distance from
+the previous stop is everyDistance, or at a meal clock time. A due stop is
+moved to the nearest waypoint, e.g. a café, within the waypoint snap distance
+after the previous stop. A stop moved past a meal time is a meal stop. The
+rider stops before the stop segment and restarts at the start speed.
+
+The stops are set from the segment times of the previous ride round, or
+before the first round from the flat ground speed, and the ride is iterated
+until the ride time converges.
+*/
+
+const startVel = 3.0 // m/s, ride start and restart speed, must be > 0
+
+// Stop is a rest stop on the route.
+type Stop struct {
+	Dist     float64 // km
+	Time     float64 // h from the start, breaks included
+	Duration float64 // min
+	Meal     bool
+	Waypoint string
+}
+
+// restStops reports whether the ride has rest stops.
+func restStops(p par) bool {
+	q := &p.RestStops
+	return q.EveryTime > 0 || q.EveryDist > 0 || len(q.Meals) > 0
+}
+
+// rideStart returns the time the rider starts to ride the segment, after the
+// rest stop and the uphill break of the segment.
+func (s *segment) rideStart() float64 { return s.timeArrival + s.timeStop + s.timeBreak }
+
+// setRestStops sets the rest stops of the road segments and the arrival times
+// with the stops.
+func (o *Route) setRestStops(p par) {
+	var (
+		q         = &p.RestStops
+		meals     = o.mealTimes(p)
+		cumDist   = make([]float64, o.segments+2)
+		base      = make([]float64, o.segments+2) // arrival times without stops
+		stops     float64                         // sum of the stop durations
+		lastTime  float64                         // end of the previous stop
+		lastDist  float64
+		last      = 1 // no stop at the start
+		meal      int
+		countMeal = func(time float64) bool { return meal < len(meals) && time >= meals[meal].time }
+	)
+	for i := 1; i <= o.segments; i++ {
+		s := &o.route[i]
+		time := s.time + s.timeBreak
+		if s.time == 0 {
+			time = s.dist / p.Powermodel.FlatSpeed
+		}
+		base[i+1] = base[i] + time
+		cumDist[i+1] = cumDist[i] + s.dist
+		s.timeStop, s.mealStop = 0, false
+	}
+	for i := 2; i <= o.segments; i++ {
+		time := base[i] + stops
+		isMeal := countMeal(time)
+		if !isMeal &&
+			!(q.EveryTime > 0 && time-lastTime >= q.EveryTime) &&
+			!(q.EveryDist > 0 && cumDist[i]-lastDist >= q.EveryDist) {
+			continue
+		}
+		duration := q.Duration
+		if isMeal {
+			duration = meals[meal].duration
+			meal++
+		}
+		if k := o.stopWaypoint(cumDist, i, last, q.WaypointSnap); k > 0 {
+			i = k
+		}
+		for countMeal(base[i] + stops) { // meals on the way to the waypoint
+			if !isMeal {
+				isMeal, duration = true, 0
+			}
+			duration = max(duration, meals[meal].duration)
+			meal++
+		}
+		s := &o.route[i]
+		s.timeStop += duration
+		s.mealStop = s.mealStop || isMeal
+		lastTime = base[i] + stops + duration
+		lastDist = cumDist[i]
+		stops += duration
+		last = i
+		for countMeal(lastTime) { // meals during the stop
+			meal++
+		}
+	}
+	stops = 0
+	for i := 1; i <= o.segments; i++ {
+		s := &o.route[i]
+		s.timeArrival = base[i] + stops
+		stops += s.timeStop
+	}
+}
+
+type mealTime struct{ time, duration float64 }
+
+// mealTimes returns the meal stop times from the ride start.
+func (o *Route) mealTimes(p par) []mealTime {
+	var (
+		t     = p.Ride.Start
+		start = float64(t.Hour()*3600 + t.Minute()*60 + t.Second())
+		meals []mealTime
+	)
+	for _, m := range p.RestStops.Meals {
+		meals = append(meals, mealTime{math.Mod(m.Clock-start+86400, 86400), m.Duration})
+	}
+	return meals
+}
+
+// stopWaypoint returns the segment of the nearest waypoint within distance
+// snap (m) from the start of segment i and after segment last, or 0.
+func (o *Route) stopWaypoint(cumDist []float64, i, last int, snap float64) int {
+	k := 0
+	for _, w := range o.waypoints {
+		if w.seg <= last || w.seg > o.segments {
+			continue
+		}
+		if d := math.Abs(cumDist[w.seg] - cumDist[i]); d <= snap {
+			k, snap = w.seg, d
+		}
+	}
+	return k
+}
+
+// setStopExitVel limits the exit speed of the segment before a rest stop
+// to the restart speed.
+func (s *segment) setStopExitVel(c *motion.BikeCalc, p par) {
+	s.vExitMax = startVel
+	vMax := max(c.MaxEntryVelNoWind(s.dist, startVel), p.Ride.MinLimitedSpeed)
+	if s.vMax <= vMax {
+		return
+	}
+	s.vMax = vMax
+	if s.vTarget > vMax {
+		s.vTarget = vMax
+		s.powerTarget = c.PowerFromVel(vMax)
+	}
+}
+
+// addRestStops adds the rest stops and the stop and elapsed times.
+func (r *Results) addRestStops(o *Route) {
+	var dist float64
+	for i := 1; i <= o.segments; i++ {
+		s := &o.route[i]
+		if s.timeStop > 0 {
+			st := Stop{
+				Dist:     dist * m2km,
+				Time:     s.timeArrival * s2h,
+				Duration: s.timeStop / 60,
+				Meal:     s.mealStop,
+			}
+			for _, w := range o.waypoints {
+				if w.seg == i {
+					st.Waypoint = w.name
+				}
+			}
+			r.Stops = append(r.Stops, st)
+			r.TimeStops += s.timeStop
+		}
+		dist += s.dist
+	}
+}
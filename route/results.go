@@ -47,9 +47,29 @@ func (o *Route) Results(c *motion.BikeCalc, p par, l *logerr.Logerr) *Results {
 		r.addRoadSegment(&rou[i], p)
 	}
 
+	r.addClockTimes(o, p, l)
+	if restStops(p) {
+		r.addRestStops(o)
+	}
+	r.TimeElapsed = r.Time + r.TimeUHBreaks + r.TimeStops
 	r.calcMiscStats(c, p)
 	r.energySums()
 	r.riderEnergy(p)
+	if groupRide(p) {
+		r.addGroupRide(o, p)
+	}
+	if nutrition(p) {
+		r.addNutrition(o, p)
+	}
+	if gearing(p) {
+		r.addGearing(o, c, p)
+	}
+	if ebike(p) {
+		r.addEbike(o, p)
+	}
+	if histograms(p) {
+		r.addHistograms(o, p)
+	}
 	r.unitConversionOut()
 	return r
 }
@@ -193,6 +213,7 @@ func (r *Results) calcMiscStats(c *motion.BikeCalc, p par) {
 	r.DownhillPowerSpeed, _ = c.NewtonRaphson(q.DownhillPower*0.01*q.FlatPower, minTolNR, 8)
 	r.DownhillPowerSpeed *= ms2kmh
 	r.RhoBase, _ = c.RhoFromEle(p.Environment.BaseElevation)
+	r.RhoBase *= p.Environment.MoistAir
 }
 
 func (r *Results) addCalculatorStats(c *motion.BikeCalc) {
@@ -213,12 +234,34 @@ func (r *Results) addRouteStats(o *Route, p par) {
 	r.RouteCourse = o.routeCourse
 	r.WindCourse = o.windCourse
 	r.WindSpeed = o.windSpeed
+	r.RideRounds = o.rounds
+	r.WindProfile = o.windProfile
+	if o.windForecast != nil {
+		r.WindCourseEnd, r.WindSpeedEnd = o.windForecast.Wind(o.finishTime())
+	}
 	r.Temperature = o.Temperature
 
 	r.BaseElevation = p.Environment.BaseElevation
 	r.MeanElevation = o.EleMean
 	r.AirPressure = p.Environment.AirPressure
 	r.Rho = o.Rho
+	if altitudePower(p) {
+		r.TimeAltitude = o.timeAltitude
+		r.AltitudePowerMin = 100 * o.powerFactMin
+	}
+	if fatigue(p) {
+		r.TimeFatigue = o.timeFatigue
+		r.WPrimeMin = o.wBalMin * p.PowerOut
+		r.WPrimeEnd = o.wBalEnd * p.PowerOut
+	}
+	if speedSchedule(p) {
+		r.SpeedSchedule = o.scheduleCurve
+	}
+	if segmentRho(p) {
+		r.RhoMin = o.rhoMin
+		r.RhoMax = o.rhoMax
+		r.TimeSegmentRho = o.timeRho
+	}
 	r.TrkpErrors = o.trkpErrors
 	r.TrkpRejected = o.trkpRejected
 	r.DistTotal = o.distance
@@ -240,6 +283,7 @@ func (r *Results) addRouteStats(o *Route, p par) {
 	r.JriderTotal = o.JouleRider
 	r.Time = o.Time
 	r.TimeTargetSpeeds = o.TimeTarget
+	r.TimeCrosswind = o.timeCrosswind
 	r.JfromTargetPower = o.JriderTarget
 	r.LatMean = o.LatMean
 	r.Gravity = o.Gravity
@@ -252,10 +296,20 @@ func (r *Results) addRoadSegment(s *segment, p par) {
 	if s.distHor <= distTol {
 		return
 	}
+	if s.walked {
+		r.DistWalk += s.dist
+		r.TimeWalk += s.time
+		r.JriderWalk += s.jouleWalk
+		r.addDists(s)
+		return
+	}
 	if s.jouleRider > 0 {
 		r.addRider(s, p)
 	}
 	r.addJoules(s)
+	if regen(p) {
+		r.addRegen(s, p)
+	}
 	r.addDists(s)
 	r.addEleUpByMomentum(s)
 	r.TimeUHBreaks += s.timeBreak
@@ -301,13 +355,14 @@ func (r *Results) addJoules(s *segment) {
 
 	jouleDrag, jouleGrav, jouleKinetic := s.jouleDrag, s.jouleGrav, s.jouleKinetic
 
-	jouleNetSum := s.jouleRider + s.jouleBrake + s.jouleRoll //+ s.jouleSink
+	jouleNetSum := s.jouleRider + s.jouleMotor + s.jouleBrake + s.jouleRoll //+ s.jouleSink
 	jouleNetSum += jouleDrag + jouleGrav + jouleKinetic
 	r.SegEnergyMeanAbs += math.Abs(jouleNetSum)
 	r.SegEnergyMean += jouleNetSum
 	s.jouleNetSum = jouleNetSum // seg s updated here
 
 	r.Jroll += s.jouleRoll
+	r.Jmotor += s.jouleMotor
 	r.Jsink += s.jouleSink
 	r.Jbraking += s.jouleBrake
 
@@ -339,7 +394,7 @@ func (r *Results) addRider(s *segment, p par) {
 	if s.powerRider > p.Powermodel.FlatPower {
 		r.TimeOverFlatPower += s.timeRider
 	}
-	Jforward := jouleRider
+	Jforward := jouleRider + s.jouleMotor
 	if jouleKinetic > 0 {
 		Jforward += jouleKinetic
 	}
@@ -369,11 +424,12 @@ func (r *Results) riderEnergy(p par) {
 	}
 	r.JriderTotal *= p.PowerOut      // here, not in unitConversionOut
 	r.JfromTargetPower *= p.PowerOut // overestimates r.JriderTotal ~5%, only
-	r.PowerRiderAvg = r.JriderTotal / (r.Time - r.TimeBraking)
+	r.PowerRiderAvg = r.JriderTotal / (r.Time - r.TimeBraking - r.TimeWalk)
 
-	r.BananaRider = r.JriderTotal * j2banana
-	r.FatRider = r.JriderTotal * j2lard
-	r.FoodRider = r.JriderTotal * j2kcal
+	r.FoodRider = (r.JriderTotal + r.JriderWalk) * j2kcal
+	r.BananaRider = (r.JriderTotal + r.JriderWalk) * j2banana
+	r.FatRider = (r.JriderTotal + r.JriderWalk) * j2lard
+	r.addFoods(p)
 	r.JlossDT = r.JriderTotal * p.Bike.DrivetrainLoss / 100
 
 	// Kinetic energy gained by acceleration is not lost. It is later used
@@ -400,6 +456,7 @@ func (r *Results) energySums() {
 	j = r.JkineticDece
 	j += r.JkineticAcce
 	j += r.Jbraking
+	j += r.Jregen
 	j += r.Jsink // if not zero, something is wrong
 	j += r.JgravUp
 	j += r.JgravDown
@@ -410,6 +467,7 @@ func (r *Results) energySums() {
 	j += r.Jroll
 	j -= r.JlossDT
 	j += r.JriderTotal
+	j += r.Jmotor
 	r.EnergySumTotal = j
 }
 
@@ -428,6 +486,12 @@ func (r *Results) unitConversionOut() {
 	r.DistUphill *= m2km
 	r.DistDownhill *= m2km
 	r.DistFlat *= m2km
+	r.DistUndergeared *= m2km
+	r.DistWalk *= m2km
+	r.RangeLeft *= m2km
+	if r.BatteryEmptyAt > 0 {
+		r.BatteryEmptyAt *= m2km
+	}
 	r.MinGrade *= 100
 	r.MaxGrade *= 100
 	r.VelAvg *= ms2kmh
@@ -443,10 +507,31 @@ func (r *Results) unitConversionOut() {
 	r.TimeBraking *= s2h
 	r.TimeFreewheel *= s2h
 	r.TimeDownhill *= s2h
+	r.TimeCrosswind *= s2h
+	r.TimeSegmentRho *= s2h
+	r.TimeAltitude *= s2h
+	r.TimeFatigue *= s2h
+	r.TimeWalk *= s2h
+	r.TimeStops *= s2h
+	r.TimeElapsed *= s2h
+	r.WPrimeMin /= 1000
+	r.WPrimeEnd /= 1000
+	r.TimeDark *= s2h
+	r.TimeFront *= s2h
+	r.TimeDraft *= s2h
+	r.DistFront *= m2km
+	r.DistDraft *= m2km
 
 	//J* is from now on Wh* *************************
 	r.JriderTotal *= j2Wh
+	r.JriderWalk *= j2Wh
+	r.Jmotor *= j2Wh
+	r.Jregen *= j2Wh
+	r.JbatteryUsed *= j2Wh
+	r.JbatteryLeft *= j2Wh
 	r.JfromTargetPower *= j2Wh
+	r.JriderFront *= j2Wh
+	r.JriderDraft *= j2Wh
 	r.JriderFullPower *= j2Wh
 	r.JriderGravUp *= j2Wh
 	r.JriderDrag *= j2Wh
@@ -9,15 +9,32 @@ import (
 // Ride calculates the ride for the given parameters and route.
 func (o *Route) Ride(c *motion.BikeCalc, p par) {
 	var (
-		prexit = 3.0 // must be > 0, start speed.
+		prexit = startVel
 		r      = o.route[1 : len(o.route)-1]
 	)
+	o.bins = newStepBins(p)
 	for i := range r {
 		s := &r[i]
+		s.bins = o.bins
 
 		c.SetGrade(s.grade)
 		c.SetWind(s.wind)
+		if segmentCdA(p) {
+			c.SetCdA(s.cdA)
+		}
+		if segmentRho(p) {
+			c.SetRho(s.rho)
+		}
 
+		if s.timeStop > 0 {
+			prexit = startVel
+		}
+		if s.walked {
+			s.walk(c, p)
+			prexit = s.vExit
+			o.Time += s.time
+			continue
+		}
 		s.distLeft = s.dist
 		s.vEntry = prexit
 		s.vExit = prexit //***
@@ -30,6 +47,12 @@ func (o *Route) Ride(c *motion.BikeCalc, p par) {
 		o.Time += s.time
 		o.JouleRider += s.jouleRider
 	}
+	if segmentCdA(p) {
+		c.SetCdA(p.Bike.CdA)
+	}
+	if segmentRho(p) {
+		c.SetRho(o.Rho)
+	}
 }
 
 func (s *segment) calcJoules(c *motion.BikeCalc) {
@@ -48,18 +71,18 @@ func (s *segment) ride(c *motion.BikeCalc, p par, o *Route) {
 		if s.vExit == s.vTarget || s.distLeft == 0 {
 			break
 		}
-		acceDecelerate(s, c, p) // decelerate from vMax to vTarget. power >= 0
+		o.acceDecelerate(s, c, p) // decelerate from vMax to vTarget. power >= 0
 
 	case s.useConstantVel(c, p):
 
 	default:
-		acceDecelerate(s, c, p)
+		o.acceDecelerate(s, c, p)
 	}
 	switch {
 	case s.distLeft == 0:
 
 	case s.vExit <= s.vExitMax:
-		s.rideConstantVel(c) // speed vExit and +/- or 0 power
+		s.rideConstantVel(c, p) // speed vExit and +/- or 0 power
 
 	case !p.Ride.LimitExitSpeeds: // && s.vExit > s.vExitMax:
 
@@ -97,11 +120,15 @@ func (s *segment) decelerateDistance(c *motion.BikeCalc, p par, vExit, vExitMax
 		s.distBrake += s.distLeft
 		s.timeBrake += time
 		s.appendPath(slowDownBrake)
+		s.bins.addStep((vExit+vExitMax)/2, time, s.distLeft, 0)
 	} else {
-		s.jouleRider += -jForce
+		motor := s.motorPower(p, -jForce/(time+1e-50), (vExit+vExitMax)/2)
+		s.jouleRider += -jForce - motor*time
+		s.jouleMotor += motor * time
 		s.jouleDragRider += -jDrag
 		s.timeRider += time
 		s.appendPath(slowDownRider)
+		s.bins.addStep((vExit+vExitMax)/2, time, s.distLeft, -jForce/(time+1e-50)-motor)
 	}
 	s.distLeft = 0
 }
@@ -117,7 +144,7 @@ func (s *segment) rideConstantVelAndBrakeAtEnd(c *motion.BikeCalc, p par) {
 		brakeExitVel := s.vExit
 		s.vExit = initialVel
 		s.calcPath /= 10
-		s.rideConstantVel(c)
+		s.rideConstantVel(c, p)
 		s.appendPath(braking)
 		s.vExit = brakeExitVel
 	}
@@ -161,7 +188,7 @@ func (s *segment) useConstantVel(c *motion.BikeCalc, p par) bool {
 	return false
 }
 
-func (s *segment) rideConstantVel(c *motion.BikeCalc) {
+func (s *segment) rideConstantVel(c *motion.BikeCalc, p par) {
 	var (
 		dist      = s.distLeft
 		vel       = s.vExit
@@ -180,10 +207,14 @@ func (s *segment) rideConstantVel(c *motion.BikeCalc) {
 	s.distLeft = 0
 	s.time += time
 	joulePower := time * power
+	rider := 0.0
 
 	switch {
 	case power > 0:
-		s.jouleRider += joulePower
+		motor := s.motorPower(p, power, vel) * time
+		rider = power - motor/time
+		s.jouleRider += joulePower - motor
+		s.jouleMotor += motor
 		s.timeRider += time
 		s.jouleDragRider += jouleDrag
 		s.distRider += dist
@@ -208,4 +239,5 @@ func (s *segment) rideConstantVel(c *motion.BikeCalc) {
 		s.appendPath(5)
 
 	}
+	s.bins.addStep(vel, time, dist, rider)
 }
@@ -0,0 +1,313 @@
+package route
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pekkizen/bikeride/gpx"
+	"github.com/pekkizen/bikeride/logerr"
+	"github.com/pekkizen/bikeride/param"
+)
+
+// testRoute returns a route of n road segments of length dist (m) to the
+// course (deg).
+func testRoute(n int, dist, course float64) *Route {
+	o := &Route{segments: n, route: make([]segment, n+2)}
+	for i := 1; i <= n; i++ {
+		s := &o.route[i]
+		s.segnum = i
+		s.dist = dist
+		s.course = course * (π / 180)
+		s.windProfile = 1
+	}
+	return o
+}
+
+type turningWind struct{}
+
+// Wind turns from the north to the east in an hour, 5 m/s.
+func (turningWind) Wind(sec float64) (course, speed float64) {
+	return min(sec/3600, 1) * 90, 5
+}
+
+func TestWindFromForecast(t *testing.T) {
+	o := testRoute(2, 1000, 0) // to the north
+	o.SetWindForecast(turningWind{})
+	o.route[2].timeArrival = 3600
+	o.windFromForecast()
+
+	if s := &o.route[1]; math.Abs(s.wind-5) > 1e-12 || math.Abs(s.windCross) > 1e-12 {
+		t.Errorf("north wind: head %g, cross %g m/s", s.wind, s.windCross)
+	}
+	if s := &o.route[2]; math.Abs(s.wind) > 1e-12 || math.Abs(s.windCross-5) > 1e-12 {
+		t.Errorf("east wind: head %g, cross %g m/s", s.wind, s.windCross)
+	}
+}
+
+func TestArrivalTimes(t *testing.T) {
+	o := testRoute(3, 600, 0)
+	p := &param.Parameters{}
+	p.Powermodel.FlatSpeed = 6
+	o.estimateArrivalTimes(p)
+	for i, want := range []float64{0, 100, 200} {
+		if got := o.route[i+1].timeArrival; got != want {
+			t.Errorf("estimated arrival %d: %g s, want %g s", i+1, got, want)
+		}
+	}
+	for i := 1; i <= 3; i++ {
+		o.route[i].time = 100
+	}
+	o.route[2].timeStop = 600
+	o.route[3].timeBreak = 60
+	o.setArrivalTimes()
+	for i, want := range []float64{0, 100, 800} {
+		if got := o.route[i+1].timeArrival; got != want {
+			t.Errorf("arrival %d: %g s, want %g s", i+1, got, want)
+		}
+	}
+}
+
+func TestCrosswindCdA(t *testing.T) {
+	p := &param.Parameters{}
+	p.Bike.CdA = 0.3
+	p.Bike.YawCdA = [][2]float64{{0, 1}, {20, 0.8}, {90, 0.8}}
+	s := &segment{wind: 2}
+	if got := s.crosswindCdA(8, p); math.Abs(got-0.3) > 1e-12 {
+		t.Errorf("head wind CdA %g, want 0.3", got)
+	}
+	// yaw 10 deg
+	s.windCross = 10 * math.Tan(10*(π/180))
+	want := 0.3 * 0.9 / math.Cos(10*(π/180))
+	if got := s.crosswindCdA(8, p); math.Abs(got-want) > 1e-12 {
+		t.Errorf("crosswind CdA %g, want %g", got, want)
+	}
+	// pure crosswind, the divisor limited to va^2 / 4
+	s.wind, s.windCross = -8, 5
+	if got := s.crosswindCdA(8, p); math.Abs(got) > 1e-12 {
+		t.Errorf("side wind CdA %g, want 0", got)
+	}
+}
+
+func TestYawRatio(t *testing.T) {
+	table := [][2]float64{{0, 1}, {10, 0.9}, {20, 0.85}}
+	for _, tc := range [][2]float64{{-5, 1}, {0, 1}, {5, 0.95}, {15, 0.875}, {30, 0.85}} {
+		if got := yawRatio(table, tc[0]); math.Abs(got-tc[1]) > 1e-12 {
+			t.Errorf("yawRatio(%g) = %g, want %g", tc[0], got, tc[1])
+		}
+	}
+}
+
+func TestSetPullPositions(t *testing.T) {
+	o := testRoute(8, 250, 0)
+	p := &param.Parameters{}
+	g := &p.Group
+	g.Size, g.PullFraction, g.PullDist = 4, 0.25, 500
+	o.setPullPositions(p)
+	for i := 1; i <= 8; i++ {
+		if want := i > 2; o.route[i].sheltered != want {
+			t.Errorf("distance pull: segment %d sheltered %v", i, !want)
+		}
+	}
+	g.PullDist, g.PullTime = 0, 100
+	for i := 1; i <= 8; i++ {
+		o.route[i].timeArrival = float64(i-1) * 100
+	}
+	o.setPullPositions(p)
+	for i := 1; i <= 8; i++ {
+		if want := (i-1)%4 != 0; o.route[i].sheltered != want {
+			t.Errorf("time pull: segment %d sheltered %v", i, !want)
+		}
+	}
+}
+
+func TestStepBins(t *testing.T) {
+	p := &param.Parameters{}
+	q := &p.Histograms
+	if newStepBins(p) != nil {
+		t.Fatal("step bins without histograms")
+	}
+	q.FTP = 200
+	q.PowerZones = []float64{0.5, 1}
+	q.SpeedBands = []float64{20 / ms2kmh}
+	b := newStepBins(p)
+	b.addStep(5, 10, 50, 150)  // 18 km/h, 75 %FTP
+	b.addStep(10, 5, 50, 0)    // 36 km/h, freewheeling
+	b.addStep(6, 20, 120, 300) // 21.6 km/h, 150 %FTP
+	b.addStep(6, 0, 0, 300)
+
+	for i, want := range []float64{10, 25} {
+		if got := b.speed.Time[i]; got != want {
+			t.Errorf("speed band %d time %g s, want %g s", i, got, want)
+		}
+	}
+	for i, want := range []float64{0, 10, 20} {
+		if got := b.power.Time[i]; got != want {
+			t.Errorf("power zone %d time %g s, want %g s", i, got, want)
+		}
+	}
+	if got := b.power.Energy[2]; got != 6000 {
+		t.Errorf("power zone energy %g J, want 6000 J", got)
+	}
+	var nilBins *stepBins
+	nilBins.addStep(5, 10, 50, 150)
+}
+
+func TestRepeatTrack(t *testing.T) {
+	loop := []gpx.Trkpt{{Lat: 60, Lon: 25}, {Lat: 60.01, Lon: 25}, {Lat: 60, Lon: 25.0002}}
+	q, err := repeatTrack(loop, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the open loop closed by the start point
+	if len(q) != 10 || q[3] != loop[0] || q[9] != loop[0] {
+		t.Errorf("laps %v", q)
+	}
+	open := []gpx.Trkpt{{Lat: 60, Lon: 25}, {Lat: 60.01, Lon: 25}}
+	if _, err := repeatTrack(open, 2); err == nil {
+		t.Error("laps of an open route")
+	}
+}
+
+func TestCutTrack(t *testing.T) {
+	tps := []gpx.Trkpt{{Lat: 60, Lon: 25, Ele: 0}, {Lat: 60.01, Lon: 25, Ele: 100}, {Lat: 60.02, Lon: 25, Ele: 0}}
+	dist := trackDist(tps)
+	from, to := dist[1]/2, dist[2]*0.75
+	q := cutTrack(tps, dist, from, to)
+	if len(q) != 3 || q[1] != tps[1] {
+		t.Fatalf("cut %v", q)
+	}
+	if d := trackDist(q); math.Abs(d[2]-(to-from)) > 1e-6 {
+		t.Errorf("cut length %g m, want %g m", d[2], to-from)
+	}
+	if math.Abs(q[0].Ele-50) > 0.01 || math.Abs(q[2].Ele-50) > 0.01 {
+		t.Errorf("cut end elevations %g and %g m, want 50 m", q[0].Ele, q[2].Ele)
+	}
+	r := roundTrip(q)
+	if len(r) != 5 || r[4] != q[0] || r[3] != q[1] {
+		t.Errorf("round trip %v", r)
+	}
+}
+
+// TestSetWaypoints maps the waypoints of a 4 km round trip to the north,
+// road segment start points every 200 m.
+func TestSetWaypoints(t *testing.T) {
+	o := testRoute(20, 200, 0)
+	o.metersLon, o.metersLat = metersLon(60), metersLat(60)
+	for i := 1; i <= 21; i++ {
+		o.route[i].lat = 60 + float64(min(i-1, 21-i))*200/o.metersLat
+		o.route[i].lon = 25
+	}
+	o.setWaypoints([]gpx.Wpt{
+		{Name: "Bridge", Lat: 60 + 430/o.metersLat, Lon: 25 + 50/o.metersLon},
+		{Name: "Start", Lat: 60, Lon: 25},
+		{Name: "Far", Lat: 61, Lon: 25},
+	})
+	want := []waypoint{{"Start", 1}, {"Bridge", 3}, {"Bridge", 19}, {"Start", 21}}
+	if len(o.waypoints) != len(want) {
+		t.Fatalf("waypoints %v, want %v", o.waypoints, want)
+	}
+	for i, w := range want {
+		if o.waypoints[i] != w {
+			t.Errorf("waypoint %d %v, want %v", i, o.waypoints[i], w)
+		}
+	}
+}
+
+// TestSunriseSunset compares to the published sunrise and sunset times.
+func TestSunriseSunset(t *testing.T) {
+	for _, tc := range []struct {
+		place     string
+		lat, lon  float64
+		utc       float64
+		day       time.Time
+		rise, set string
+	}{
+		{"Helsinki", 60.17, 24.94, 3, time.Date(2024, 6, 20, 12, 0, 0, 0, time.UTC), "3:54", "22:50"},
+		{"Helsinki", 60.17, 24.94, 2, time.Date(2024, 12, 21, 12, 0, 0, 0, time.UTC), "9:24", "15:13"},
+		{"London", 51.51, -0.13, 0, time.Date(2024, 3, 20, 12, 0, 0, 0, time.UTC), "6:02", "18:14"},
+		{"Madrid", 40.42, -3.70, 2, time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC), "6:48", "21:49"},
+	} {
+		rise, set, ok := sunriseSunset(tc.day, tc.lat, tc.lon, tc.utc)
+		if !ok || !nearClock(rise, tc.rise) || !nearClock(set, tc.set) {
+			t.Errorf("%s %s: sunrise %s, sunset %s, want %s and %s", tc.place,
+				tc.day.Format("2006-01-02"), hhmm(rise), hhmm(set), tc.rise, tc.set)
+		}
+	}
+	midsummer := time.Date(2024, 6, 21, 12, 0, 0, 0, time.UTC)
+	if rise, set, ok := sunriseSunset(midsummer, 69.9, 27.0, 3); ok || rise != 0 || set != 24 {
+		t.Errorf("midnight sun: %g, %g, %v", rise, set, ok)
+	}
+	midwinter := time.Date(2024, 12, 21, 12, 0, 0, 0, time.UTC)
+	if rise, set, ok := sunriseSunset(midwinter, 69.9, 27.0, 2); ok || rise != 12 || set != 12 {
+		t.Errorf("polar night: %g, %g, %v", rise, set, ok)
+	}
+}
+
+// nearClock reports whether hours is within two minutes of the clock time
+// hh:mm.
+func nearClock(hours float64, hhmm string) bool {
+	c, err := time.Parse("15:04", hhmm)
+	return err == nil && math.Abs(hours*60-float64(c.Hour()*60+c.Minute())) <= 2
+}
+
+// TestTimeDark rides four hours in Helsinki from 14:00 at the winter solstice,
+// sunset at 15:13.
+func TestTimeDark(t *testing.T) {
+	o := testRoute(4, 20000, 0)
+	o.LatMean, o.lonMean = 60.17, 24.94
+	for i := 1; i <= 4; i++ {
+		s := &o.route[i]
+		s.time = 3600
+		s.timeArrival = float64(i-1) * 3600
+	}
+	o.waypoints = []waypoint{{"Cafe", 3}}
+	p := &param.Parameters{}
+	p.Ride.StartTime = "2024-12-21T14:00:00+02:00"
+	p.Ride.Start = time.Date(2024, 12, 21, 14, 0, 0, 0, time.FixedZone("EET", 2*3600))
+
+	r := &Results{}
+	r.addClockTimes(o, p, logerr.New())
+	if r.UTCOffset != 2 || r.Sunset != "15:13" || r.FinishClock != "18:00:00" {
+		t.Errorf("UTC offset %g, sunset %s, finish %s", r.UTCOffset, r.Sunset, r.FinishClock)
+	}
+	// the segment midpoints 15:30, 16:30 and 17:30 in the dark
+	if r.TimeDark != 3*3600 {
+		t.Errorf("dark time %g s, want %d s", r.TimeDark, 3*3600)
+	}
+	if len(r.Waypoints) != 1 || r.Waypoints[0].Arrival != "16:00:00" || r.Waypoints[0].Dist != 40 {
+		t.Errorf("waypoints %v", r.Waypoints)
+	}
+}
+
+// TestRestStopMeal moves the hourly stop from 9:00 to a café ten minutes
+// later, past the 9:05 lunch time, and makes it the lunch stop.
+func TestRestStopMeal(t *testing.T) {
+	o := testRoute(10, 3000, 0)
+	for i := 1; i <= 10; i++ {
+		o.route[i].time = 600
+	}
+	o.waypoints = []waypoint{{"Café", 8}}
+	p := &param.Parameters{}
+	p.Ride.Start = time.Date(2024, 5, 18, 8, 0, 0, 0, time.UTC)
+	q := &p.RestStops
+	q.EveryTime, q.Duration, q.WaypointSnap = 3600, 900, 5000
+	q.Meals = slices.Grow(q.Meals, 1)[:1]
+	q.Meals[0].Clock, q.Meals[0].Duration = 9*3600+300, 1800
+	o.setRestStops(p)
+
+	for i := 1; i <= 10; i++ {
+		s := &o.route[i]
+		want := 0.0
+		if i == 8 {
+			want = 1800
+		}
+		if s.timeStop != want || s.mealStop != (want > 0) {
+			t.Errorf("segment %d stop %g s meal %v, want %g s", i, s.timeStop, s.mealStop, want)
+		}
+	}
+	if got := o.route[9].timeArrival; got != 8*600+1800 {
+		t.Errorf("arrival after the stop %g s, want %d s", got, 8*600+1800)
+	}
+}
@@ -29,7 +29,9 @@ func (o *Route) checkRide(p par, l *logerr.Logerr) {
 	for i := 1; i <= o.segments; i++ {
 		s := &r[i]
 		n := s.segnum
-
+		if s.walked {
+			continue
+		}
 		if (s.calcPath == 4 || s.calcPath == 5) && s.vEntry != s.vExit {
 			l.SegMsg(1, n, "Constant velocity and vEntry != vExit,", s.calcPath)
 		}
@@ -110,6 +112,9 @@ func (o *Route) checkRideSetup(p par, l *logerr.Logerr) {
 		s := &o.route[i]
 		n := s.segnum
 		v := 3.6 * s.vTarget
+		if s.walked {
+			continue
+		}
 
 		if s.vTarget > s.vMax {
 			l.SegMsg(1, n, "vTarget > vMax, ", s.calcPath)
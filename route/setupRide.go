@@ -5,49 +5,102 @@ import (
 )
 
 func (o *Route) SetupRide(c *motion.BikeCalc, power ratioGenerator, p par) error {
-	setAccelerationStepping(p.AcceStepMode)
+	o.setAccelerationStepping(p.AcceStepMode)
 	c.SetMinPower(powerTol)
+	o.powerFactMin = 1
+	o.drivetrain = newDrivetrain(p)
+	if speedSchedule(p) {
+		o.setSchedulePowerCurve(c, power, p)
+	}
+	if groupRide(p) {
+		o.setPullPositions(p)
+	}
 
 	var (
 		r    = o.route
 		s    = &r[len(r)-1]
 		next *segment
 	)
-	s.vMax = 3.0
+	s.vMax = startVel
 	for i := len(r) - 2; i > 0; i-- {
 		next, s = s, &r[i]
 
 		c.SetGrade(s.grade)
 		c.SetWind(s.wind)
+		if segmentRho(p) {
+			c.SetRho(o.Rho) // baseline of each segment at the route air density
+		}
+		if segmentCdA(p) {
+			s.cdA = p.Bike.CdA
+			c.SetCdA(s.cdA) // and at the still air solo CdA
+		}
 
+		s.powerFactor = 1
 		if e := s.setTargetVelAndPower(c, p, power); e != nil {
 			return e
 		}
-		s.adjustTargetVelByMaxMinPedaled(c, p)
+		if walking(p) && s.setWalk(c, p, o) {
+			s.calcJoulesAndTimeFromTargets(o, p)
+			continue
+		}
+		if altitudePower(p) {
+			if e := s.setAltitudeTargetVel(c, p, power, o, next); e != nil {
+				return e
+			}
+		}
+		if segmentRho(p) {
+			if e := s.setSegmentRhoTargetVel(c, p, power, o); e != nil {
+				return e
+			}
+		}
+		if yawDrag(p) {
+			if e := s.setCrosswindTargetVel(c, p, power, o); e != nil {
+				return e
+			}
+		}
+		if fatigue(p) {
+			if e := s.setFatigueTargetVel(c, p, power, o); e != nil {
+				return e
+			}
+		}
+		if groupRide(p) && s.sheltered {
+			s.setDraftTarget(c, p)
+		}
+		s.adjustTargetVelByMaxMinPedaled(c, p, o)
 		s.setMaxVel(c, p, next)
-		s.calcJoulesAndTimeFromTargets(o)
+		if next.timeStop > 0 {
+			s.setStopExitVel(c, p)
+		}
+		s.calcJoulesAndTimeFromTargets(o, p)
+	}
+	if segmentCdA(p) {
+		c.SetCdA(p.Bike.CdA)
+	}
+	if segmentRho(p) {
+		c.SetRho(o.Rho)
 	}
 	return nil
 }
 
-func (s *segment) calcJoulesAndTimeFromTargets(o *Route) {
+func (s *segment) calcJoulesAndTimeFromTargets(o *Route, p par) {
 	timeTarget := s.dist / s.vTarget
 	if s.powerTarget > 0 {
-		o.JriderTarget += timeTarget * 0.95 * s.powerTarget // est. 5% less
+		power := s.powerTarget - s.motorPower(p, s.powerTarget, s.vTarget)
+		o.JriderTarget += timeTarget * 0.95 * power // est. 5% less
 	}
 	o.TimeTarget += timeTarget
 }
 
-func setAccelerationStepping(i int) {
+func (o *Route) setAccelerationStepping(i int) {
 	switch i {
 	case stepVel: // 1
-		acceDecelerate = (*segment).acceDeceVel
+		o.acceDecelerate = (*segment).acceDeceVel
 	case stepTime: // 2
-		acceDecelerate = (*segment).acceDeceTime
+		o.acceDecelerate = (*segment).acceDeceTime
 	case stepDist: // 3
-		acceDecelerate = (*segment).acceDeceDist
+		o.acceDecelerate = (*segment).acceDeceDist
 	default:
-		acceDecelerate = (*segment).acceDeceVel
+		o.acceDecelerate = (*segment).acceDeceVel
 	}
 }
 
@@ -61,7 +114,17 @@ func (s *segment) setTargetVelAndPower(c *motion.BikeCalc, p par, power ratioGen
 	}
 	// This is the core idea of the system
 	var ok bool
-	s.powerTarget = p.Powermodel.FlatPower * power.Ratio(s.grade, s.wind)
+	s.powerTarget = p.Powermodel.FlatPower * power.Ratio(s.grade, s.wind) * s.powerFactor
+	s.powerRiderTarget = s.powerTarget
+	if vel, scheduled := power.TargetVel(s.grade, s.wind); scheduled {
+		// Speed schedule pacing: the power of the target speed. Below the
+		// freewheel speed the power is the minimum power ratio 0.001.
+		pow := max(c.PowerFromVel(vel), 0.001*p.Powermodel.FlatPower)
+		s.powerTarget = pow * s.powerFactor
+		s.powerRiderTarget = 0 // motor share by the assist only
+	} else if ebike(p) {
+		s.powerTarget = assistedPower(c, p, s.powerTarget)
+	}
 	s.vTarget, ok = c.VelFromPower(s.powerTarget, -1) // -1 -> use motion velguess function
 	if !ok {
 		return errNew(" setTargetVelAndPower: velocity is not solvable: " + c.Error())
@@ -69,15 +132,15 @@ func (s *segment) setTargetVelAndPower(c *motion.BikeCalc, p par, power ratioGen
 	return nil
 }
 
-func (s *segment) adjustTargetVelByMaxMinPedaled(c *motion.BikeCalc, p par) {
+func (s *segment) adjustTargetVelByMaxMinPedaled(c *motion.BikeCalc, p par, o *Route) {
 	var (
 		maxPedaled = p.Powermodel.MaxPedaledSpeed
-		minSpeed   = p.Ride.MinSpeed
+		minSpeed   = o.minRideVel(p) // minSpeed or the lowest gear speed
 	)
 	if s.powerTarget == 0 && s.vTarget > maxPedaled {
 		return
 	}
-	if s.vTarget < minSpeed { // minspeed < 0 -> minspeed not set
+	if s.vTarget < minSpeed { // minspeed 0 -> not set
 		s.vTarget = minSpeed
 		s.powerTarget = c.PowerFromVel(minSpeed)
 		return
@@ -111,6 +174,10 @@ func (s *segment) setMaxVel(c *motion.BikeCalc, p par, next *segment) {
 			vMax = vDown
 		}
 	}
+	// a descent coasting over the regen speed is held at it by regenerative braking
+	if regenDescent(p) && s.vFreewheel > p.Ebike.RegenSpeed && vMax > p.Ebike.RegenSpeed {
+		vMax = p.Ebike.RegenSpeed
+	}
 	if q.LimitTurnSpeeds && s.radius < noLimRadius && s.grade < turnGradeLim {
 		if vTurn := c.VelFromTurnRadius(s.radius); vMax > vTurn {
 			vMax = vTurn
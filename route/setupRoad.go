@@ -4,6 +4,9 @@ import (
 	"math"
 )
 
+// SetWindField sets a location dependent wind for the route.
+func (o *Route) SetWindField(w windFielder) { o.windField = w }
+
 func (o *Route) SetupRoad(p par) {
 	const radius = 6371.0 // Earth mean radius in km
 	// radius := earthRadiusByLatitude(o.LatMean)
@@ -17,8 +20,13 @@ func (o *Route) SetupRoad(p par) {
 	o.metersLon = metersLon(o.LatMean) * eleCorrection
 	o.metersLat = metersLat(o.LatMean) * eleCorrection
 
-	o.setWind(p.Environment.WindCourse, p.Environment.WindSpeed)
+	course, speed := p.Environment.WindCourse, p.Environment.WindSpeed
+	if o.windForecast != nil {
+		course, speed = o.windForecast.Wind(0)
+	}
+	o.setWind(course, speed)
 	o.setupSegments()
+	o.setWindProfile(p)
 	if p.Ride.LimitTurnSpeeds {
 		o.turnRadius()
 	}
@@ -45,6 +53,7 @@ func (o *Route) setupSegments() {
 		median     = 0.6 * o.distMean
 		weight     = 5.0 * median
 		windSpeed  = o.windSpeed
+		uSum, vSum float64
 	)
 	for i := 2; i < len(o.route); i++ {
 		s, next = next, &o.route[i]
@@ -65,9 +74,16 @@ func (o *Route) setupSegments() {
 		distSum += distRoad
 		distHorSum += distHor
 		switch {
+		case o.windField != nil: // Wind field at the segment midpoint
+			u, v := o.windField.UV((s.lat+next.lat)/2, (s.lon+next.lon)/2)
+			s.wind = -(dLon*u + dLat*v) / distHor
+			s.windCross = (dLon*v - dLat*u) / distHor
+			uSum += u * distHor
+			vSum += v * distHor
 		case windSpeed == 0:
 		case o.windCourse >= 0: // Wind component of riding direction.
 			s.wind = windSpeed / distHor * (dLon*o.windSin + dLat*o.windCos)
+			s.windCross = windSpeed / distHor * (dLat*o.windSin - dLon*o.windCos)
 			// s.wind = math.Cos(o.windCourse-s.course) * windSpeed // by trig
 		case o.windCourse == -1: // Constant wind, head or tail
 			s.wind = windSpeed
@@ -91,6 +107,21 @@ func (o *Route) setupSegments() {
 	o.distGPX = distSum
 	dEle := o.route[o.segments+1].ele - o.route[1].ele
 	o.distLine = math.Sqrt(distHorSum*distHorSum + dEle*dEle)
+	if o.windField != nil {
+		o.meanFieldWind(uSum/distHorSum, vSum/distHorSum)
+	}
+}
+
+// meanFieldWind sets the route wind course and speed from the distance
+// weighted mean wind field components u and v. The wind course is the
+// direction the wind comes from.
+func (o *Route) meanFieldWind(u, v float64) {
+	speed := math.Sqrt(u*u + v*v)
+	if speed == 0 {
+		o.setWind(0, 0)
+		return
+	}
+	o.setWind(math.Mod(math.Atan2(-u, -v)*(180/π)+360, 360), speed)
 }
 
 /*
@@ -16,12 +16,30 @@ type par *param.Parameters
 // The ratioGenerator interface is implemented by package power and
 // gen := power.RatioGenerator() in package main/bikeride.go.
 // The Ratio method is called once for each (almost) road segment in the function setupRide.
+// TargetVel gives the target speed of the speed schedule pacing model and
+// ok is false for the power ratio models.
 type ratioGenerator interface {
 	Ratio(grade, wind float64) (ratio float64)
+	TargetVel(grade, wind float64) (vel float64, ok bool)
 }
 
-// acceDecelerate holds the actual acce/deceleration function.
-var acceDecelerate func(*segment, *motion.BikeCalc, par)
+// windForecaster gives the wind course (deg) and speed (m/s) at time sec
+// seconds from the ride start. The interface is implemented by package weather.
+type windForecaster interface {
+	Wind(sec float64) (course, speed float64)
+}
+
+// windFielder gives the eastward u and northward v wind components (m/s)
+// at a location. Implemented by package weather.
+type windFielder interface {
+	UV(lat, lon float64) (u, v float64)
+}
+
+// temperatureForecaster gives the temperature (C) at time sec seconds from
+// the ride start, if known. Implemented by package weather.
+type temperatureForecaster interface {
+	Temperature(sec float64) (temp float64, ok bool)
+}
 
 // signbit returns the signbit of x as uint64. 0 for positive and 1 for negative numbers.
 // math.Signbit(x) returns a bool.
@@ -74,15 +92,7 @@ const (
 	test        = true
 )
 
-/*
-https://fineli.fi/fineli/en/elintarvikkeet/11049?portionUnit=KPL_M&portionSize=1
-Banana, without skin: 1 medium sized piece 125 g = 458 kJ
-Lard, Frying Fat 3591 kJ / 100 g
-Lord is a semi-solid white fat product obtained by rendering
-the fatty tissue of a pig. It is distinguished from tallow,
-a similar product derived from fat of cattle or sheep.
-Tallow, Beef Fat: 3,684 kJ / 100 g
-*/
+// Bananas and lard as in the default nutrition foods table, see there.
 const (
 	humanEfficiency = 0.24
 	banana2Wh       = 458.0 * kj2wh
@@ -126,6 +136,13 @@ func errNew(txt string) error { return &errstr{txt} }
 
 func (o *Route) Segments() int { return o.segments }
 
+// SegmentRoad returns the distance (m), grade and wind (m/s, + headwind) of
+// road segment i, 1 <= i <= Segments().
+func (o *Route) SegmentRoad(i int) (dist, grade, wind float64) {
+	s := &o.route[i]
+	return s.dist, s.grade, s.wind
+}
+
 type filter struct {
 	minSegDist float64
 
@@ -168,9 +185,20 @@ type segment struct {
 	radius  float64
 	wind    float64
 
-	powerTarget  float64
-	powerRider   float64
-	powerBraking float64
+	windCross   float64 // crosswind component, + from the right
+	windProfile float64 // rider height wind / measured wind
+	cdA         float64 // yaw angle and draft dependent effective CdA
+	sheltered   bool    // group ride draft position
+	bins        *stepBins
+	rho         float64 // air density at the segment elevation
+	powerFactor float64 // altitude and endurance rider power factor
+	temperature float64 // temperature at the segment elevation
+	wBal        float64 // W' balance at the segment arrival
+
+	powerTarget      float64
+	powerRider       float64
+	powerBraking     float64
+	powerRiderTarget float64 // rider part of the target power with motor assist
 
 	vTarget    float64
 	vEntry     float64
@@ -191,6 +219,8 @@ type segment struct {
 	jouleDragBrake  float64
 	jouleSink       float64
 	jouleNetSum     float64
+	jouleMotor      float64
+	jouleRegen      float64 // regenerated of jouleBrake
 
 	distKinetic   float64
 	distLeft      float64
@@ -203,6 +233,11 @@ type segment struct {
 	timeBrake     float64
 	timeFreewheel float64
 	timeBreak     float64
+	timeStop      float64 // rest stop at the segment start
+	timeArrival   float64 // from the ride start, breaks included
+	mealStop      bool
+	walked        bool    // hike-a-bike
+	jouleWalk     float64 // walking energy
 
 	calcSteps int
 	calcPath  int
@@ -232,6 +267,35 @@ type Route struct {
 	metersLon   float64
 	metersLat   float64
 
+	windForecast windForecaster
+	windField    windFielder
+	windProfile  float64 // distance weighted mean
+	rounds       int     // ride calculation rounds
+	converged    bool    // ride time converged in the rounds
+
+	// acceDecelerate is the acce/deceleration function by acceStepMode
+	acceDecelerate func(*segment, *motion.BikeCalc, par)
+
+	timeCrosswind float64 // target speed time lost to crosswinds
+
+	waypoints []waypoint
+	lonMean   float64
+
+	tempForecast temperatureForecaster
+	timeRho      float64 // target speed time difference to mean rho
+	timeAltitude float64 // target speed time lost to altitude
+	powerFactMin float64
+	rhoMin       float64
+	rhoMax       float64
+
+	timeFatigue float64 // target speed time lost to fatigue
+	wBalMin     float64
+	wBalEnd     float64
+
+	scheduleCurve []SchedulePoint // implied power curve of the speed schedule
+	drivetrain    *drivetrain     // nil without gearing
+	bins          *stepBins       // step histograms of the last ride, nil without
+
 	eleUp      float64
 	eleDown    float64
 	eleUpGPX   float64
@@ -257,6 +321,10 @@ type Results struct {
 	jouleK        [2]float64
 	WindCourse    float64
 	WindSpeed     float64
+	WindCourseEnd float64
+	WindSpeedEnd  float64
+	WindProfile   float64
+	RideRounds    int
 	RouteCourse   float64
 	BaseElevation float64
 	AirPressure   float64
@@ -264,6 +332,8 @@ type Results struct {
 	Temperature   float64
 	Rho           float64
 	RhoBase       float64
+	RhoMin        float64
+	RhoMax        float64
 	Segments      int
 	TrkpErrors    int
 	TrkpRejected  int
@@ -316,6 +386,13 @@ type Results struct {
 	TimeOverFlatPower float64
 	TimeTargetSpeeds  float64
 	TimeDownhill      float64
+	TimeCrosswind     float64
+	TimeSegmentRho    float64
+	TimeAltitude      float64
+	TimeFatigue       float64
+	TimeStops         float64
+	TimeElapsed       float64
+	Stops             []Stop
 
 	VelAvg             float64
 	VelMax             float64
@@ -325,12 +402,61 @@ type Results struct {
 	VerticalDownEle    float64
 	DownhillMaxSpeed   float64
 	MaxGradeUp         float64
+	AltitudePowerMin   float64
+	WPrimeMin          float64
+	WPrimeEnd          float64
 	DownhillPowerSpeed float64
+	SpeedSchedule      []SchedulePoint
+
+	GearLowSpeed        float64
+	GearTopSpeed        float64
+	MaxGradeLowGear     float64
+	DistUndergeared     float64
+	SegmentsUndergeared int
+	ClimbSpeeds         []ClimbSpeed
+
+	DistWalk   float64
+	TimeWalk   float64
+	JriderWalk float64
+
+	Jmotor          float64
+	Jregen          float64
+	JbatteryUsed    float64
+	JbatteryLeft    float64
+	BatteryUsedPros float64
+	RangeLeft       float64
+	BatteryEmptyAt  float64
+
+	PowerZones *Histogram
+	SpeedBands *Histogram
+	GradeBands *Histogram
 
 	JriderTotal float64
 	FoodRider   float64
 	BananaRider float64
 	FatRider    float64
+	Foods       []FoodAmount
+
+	Carbs         float64 // g
+	Fluid         float64 // l
+	CarriedLoad   float64 // kg
+	WaterResupply float64 // l
+	Feeds         []Feed
+
+	UTCOffset   float64
+	StartClock  string
+	FinishClock string
+	Sunrise     string
+	Sunset      string
+	TimeDark    float64
+	Waypoints   []Waypoint
+
+	JriderFront float64
+	JriderDraft float64
+	TimeFront   float64
+	TimeDraft   float64
+	DistFront   float64
+	DistDraft   float64
 
 	JfromTargetPower float64
 	JriderFullPower  float64
@@ -0,0 +1,40 @@
+package route
+
+import "github.com/pekkizen/motion"
+
+/*
+Speed schedule pacing (powerModel 6) gives the target speeds by grade and
+wind instead of the power ratios. The target power of a road segment is
+solved from the target speed and the ride goes on from the target power as
+with the power ratio models. The implied power curve of the schedule, the
+power by grade in calm, is reported in the results.
+*/
+
+// SchedulePoint is a point of the implied power curve of the speed schedule.
+type SchedulePoint struct {
+	Grade float64 // %
+	Speed float64 // km/h
+	Power float64 // W
+}
+
+// speedSchedule reports whether the ride is paced by a speed schedule.
+func speedSchedule(p par) bool { return p.Powermodel.PowermodelType == 6 }
+
+// setSchedulePowerCurve sets the implied power curve of the speed schedule
+// at the schedule grades in calm.
+func (o *Route) setSchedulePowerCurve(c *motion.BikeCalc, power ratioGenerator, p par) {
+	o.scheduleCurve = o.scheduleCurve[:0]
+	for _, grade := range p.Powermodel.SpeedSchedule.Grade {
+		vel, ok := power.TargetVel(grade, 0)
+		if !ok {
+			return
+		}
+		c.SetGrade(grade)
+		c.SetWind(0)
+		o.scheduleCurve = append(o.scheduleCurve, SchedulePoint{
+			Grade: grade * 100,
+			Speed: vel * ms2kmh,
+			Power: c.PowerFromVel(vel) * p.PowerOut,
+		})
+	}
+}
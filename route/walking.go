@@ -0,0 +1,75 @@
+package route
+
+import (
+	"math"
+
+	"github.com/pekkizen/motion"
+)
+
+/*
+Hike-a-bike. The rider walks the uphill segments steeper than walkGrade or
+where riding at the min speed needs more than walkPowerLimit of the uphill
+power. The min speed is the speed of the lowest gear at the min cadence if
+it is over minSpeed. The walking speed is Tobler's hiking function
+
+	v = walkMaxSpeed * exp(-3.5 * |grade + 0.05|)
+
+and the walking power lifts the rider and the bike and pays the level
+walking cost walkCost (J/kg/m) of the total weight. A walked segment is
+entered and left at the walking speed, it has no rider, braking or
+resistance energies and the walking energy is reported apart from the ride
+energies.
+*/
+
+// walking reports whether the rider walks the unrideable grades.
+func walking(p par) bool {
+	q := &p.Walking
+	return q.Grade > 0 || q.PowerLimit > 0
+}
+
+// walkVel returns the walking speed at grade by Tobler's hiking function.
+func walkVel(grade, maxVel float64) float64 {
+	return maxVel * math.Exp(-3.5*math.Abs(grade+0.05))
+}
+
+// minRideVel returns the min riding speed, minSpeed or the lowest gear speed
+// at the min cadence, or 0 if neither is set.
+func (o *Route) minRideVel(p par) float64 {
+	vel := max(p.Ride.MinSpeed, 0)
+	if d := o.drivetrain; d != nil {
+		vel = max(vel, d.gears[0].ratio*d.minCadence)
+	}
+	return vel
+}
+
+// setWalk sets segment s walked and the walking target speed, if the grade
+// is not rideable. It reports whether s is walked.
+func (s *segment) setWalk(c *motion.BikeCalc, p par, o *Route) bool {
+	var (
+		q       = &p.Walking
+		vMin    = o.minRideVel(p)
+		maxPow  = q.PowerLimit * p.Powermodel.UphillPower
+		steep   = q.Grade > 0 && s.grade >= q.Grade
+		tooHard = q.PowerLimit > 0 && vMin > 0 && c.PowerFromVel(vMin) > maxPow
+	)
+	s.walked = s.grade > 0 && (steep || tooHard)
+	if !s.walked {
+		return false
+	}
+	s.vTarget = walkVel(s.grade, q.MaxSpeed)
+	s.powerTarget = 0
+	s.vMax = s.vTarget
+	s.vExitMax = 9999
+	return true
+}
+
+// walk calculates the walked segment s.
+func (s *segment) walk(c *motion.BikeCalc, p par) {
+	vel := s.vTarget
+	s.vEntry, s.vExit = vel, vel
+	s.time = s.dist / vel
+	s.distLeft = 0
+	power := vel * (max(c.Fgrav(), 0) + p.Bike.Weight.Total*p.Walking.Cost)
+	s.jouleWalk = power * s.time
+	s.bins.addStep(vel, s.time, s.dist, 0)
+}
@@ -0,0 +1,59 @@
+package route
+
+import "math"
+
+/*
+Forecast and weather station wind speeds are for 10 m height. Near the ground
+the terrain roughness slows the wind down. The wind at the rider height z is
+approximated by the power law wind profile
+
+	w(z) = w(zm) * (z / zm)^α
+
+where zm is the measurement height and the exponent α grows with the terrain
+roughness. From 10 m to 1 m the wind is 69 % in open terrain, 52 % in suburbs
+and 40 % in forest.
+*/
+
+const riderWindHeight = 1.0 // m
+
+var windShearExponent = map[string]float64{
+	"open":     0.16,
+	"suburban": 0.28,
+	"forest":   0.40,
+}
+
+// windProfileFactor returns the ratio of the wind at the rider height to the
+// wind at the measurement height. Unknown terrain gives 1.
+func windProfileFactor(terrain string, height float64) float64 {
+	a, ok := windShearExponent[terrain]
+	if !ok || height <= 0 {
+		return 1
+	}
+	return math.Pow(riderWindHeight/height, a)
+}
+
+// setWindProfile sets the wind profile factors of the road segments by the
+// terrain at the segment midpoint and scales the segment winds.
+func (o *Route) setWindProfile(p par) {
+	var (
+		e       = &p.Environment
+		dist    float64
+		profSum float64
+	)
+	for i := 1; i <= o.segments; i++ {
+		s := &o.route[i]
+		terrain := e.Terrain
+		mid := dist + s.dist/2
+		for _, t := range e.TerrainSections {
+			if t.From <= mid && mid < t.To {
+				terrain = t.Terrain
+			}
+		}
+		dist += s.dist
+		s.windProfile = windProfileFactor(terrain, e.WindHeight)
+		s.wind *= s.windProfile
+		s.windCross *= s.windProfile
+		profSum += s.windProfile * s.dist
+	}
+	o.windProfile = profSum / dist
+}
@@ -3,6 +3,7 @@ package route
 import (
 	"encoding/json"
 	"io"
+	"strings"
 
 	"github.com/pekkizen/bikeride/logerr"
 	"github.com/pekkizen/motion"
@@ -51,7 +52,7 @@ func (r *Results) WriteJSON(writer io.WriteCloser) error {
 	return err
 }
 
-func headerLine(b []byte, sep byte, useCR bool) []byte {
+func headerLine(b []byte, sep byte, clockTimes, wBal, gears, motor, useCR bool) []byte {
 	b = append(b, "seg"...)
 	b = append(b, sep)
 	b = append(b, "lat"...)
@@ -83,6 +84,10 @@ func headerLine(b []byte, sep byte, useCR bool) []byte {
 	b = append(b, sep)
 	b = append(b, "pBrake"...)
 	b = append(b, sep)
+	if motor {
+		b = append(b, "pMotor"...)
+		b = append(b, sep)
+	}
 
 	b = append(b, "vFreew"...)
 	b = append(b, sep)
@@ -101,11 +106,27 @@ func headerLine(b []byte, sep byte, useCR bool) []byte {
 	b = append(b, sep)
 	b = append(b, "cumDist"...)
 	b = append(b, sep)
+	if clockTimes {
+		b = append(b, "clock"...)
+		b = append(b, sep)
+	}
+	if gears {
+		b = append(b, "gear"...)
+		b = append(b, sep)
+		b = append(b, "cadence"...)
+		b = append(b, sep)
+		b = append(b, "underGeared"...)
+		b = append(b, sep)
+	}
 	b = append(b, "calcP"...)
 	b = append(b, sep)
 	b = append(b, "calcS"...)
 	b = append(b, sep)
 	b = append(b, "jSum"...)
+	if wBal {
+		b = append(b, sep)
+		b = append(b, "wBal"...)
+	}
 
 	if useCR {
 		b = append(b, '\r')
@@ -122,7 +143,10 @@ func (o *Route) makeRouteCSV(b []byte, p par) []byte {
 	}
 	var cumsec, cumdist float64
 
-	b = headerLine(b, sep, p.UseCR)
+	clockTimes := p.Ride.StartTime != ""
+	start, _ := o.clockStart(p)
+	d := o.drivetrain
+	b = headerLine(b, sep, clockTimes, fatigue(p), d != nil, ebike(p), p.UseCR)
 
 	for i := 1; i <= o.segments; i++ {
 		s := &o.route[i]
@@ -144,6 +168,9 @@ func (o *Route) makeRouteCSV(b []byte, p par) []byte {
 		b = numconv.Ftoa80(b, powerTarget, sep)
 		b = numconv.Ftoa80(b, s.powerRider*p.PowerOut, sep)
 		b = numconv.Ftoa80(b, s.powerBraking, sep)
+		if ebike(p) {
+			b = numconv.Ftoa80(b, s.jouleMotor/max(s.timeRider, 1e-50), sep)
+		}
 		b = numconv.Ftoa82(b, s.vFreewheel*ms2kmh, sep)
 		b = numconv.Ftoa82(b, s.vTarget*ms2kmh, sep)
 		b = numconv.Ftoa82(b, s.vMax*ms2kmh, sep)
@@ -152,13 +179,27 @@ func (o *Route) makeRouteCSV(b []byte, p par) []byte {
 		b = numconv.Ftoa82(b, s.time, sep)
 		b = numconv.Ftoa83(b, cumsec*s2h, sep)
 		b = numconv.Ftoa83(b, cumdist*m2km, sep)
+		if clockTimes {
+			b = clock(start, s.timeArrival).AppendFormat(b, "15:04:05")
+			b = append(b, sep)
+		}
+		if d != nil {
+			b = appendGear(b, d, s, sep)
+		}
 		b = numconv.Utoa8(b, uint64(s.calcPath), sep)
 		b = numconv.Utoa8(b, uint64(s.calcSteps), sep)
+		eol := byte('\n')
 		if p.UseCR {
-			b = numconv.Ftoa81(b, s.jouleNetSum, '\r')
-			b = append(b, '\n')
+			eol = '\r'
+		}
+		if fatigue(p) {
+			b = numconv.Ftoa81(b, s.jouleNetSum, sep)
+			b = numconv.Ftoa82(b, s.wBal*p.PowerOut/1000, eol)
 		} else {
-			b = numconv.Ftoa81(b, s.jouleNetSum, '\n')
+			b = numconv.Ftoa81(b, s.jouleNetSum, eol)
+		}
+		if p.UseCR {
+			b = append(b, '\n')
 		}
 		cumdist += s.dist
 		cumsec += s.time
@@ -225,6 +266,21 @@ func (r *Results) makeResultTXT(b []byte, p par) []byte {
 		b = append(b, le+"Environment"+le...)
 		b = wI(b, "\tWind course (deg)       ", r.WindCourse, le)
 		b = wF(b, "\tWind speed (m/s)        ", r.WindSpeed, d1, le)
+		if p.Environment.WindForecast != "" {
+			b = wS(b, "\tWind forecast           ", p.Environment.WindForecast, le)
+			b = wS(b, "\t    ride start          ", p.Ride.StartTime, le)
+			b = wI(b, "\t    course at end (deg) ", r.WindCourseEnd, le)
+			b = wF(b, "\t    speed at end (m/s)  ", r.WindSpeedEnd, d1, le)
+			b = wI(b, "\t    calculation rounds  ", float64(r.RideRounds), le)
+		}
+		if p.Environment.WindField != "" {
+			b = wS(b, "\tWind field              ", p.Environment.WindField, le)
+		}
+		if p.Environment.Terrain != "" || len(p.Environment.TerrainSections) > 0 {
+			b = wS(b, "\tTerrain                 ", p.Environment.Terrain, le)
+			b = wI(b, "\t    wind height (m)     ", p.Environment.WindHeight, le)
+			b = wI(b, "\t    rider wind (%)      ", 100*r.WindProfile, le)
+		}
 		if r.RouteCourse >= 0 {
 			b = wI(b, "\tRoute course (deg)      ", r.RouteCourse, le)
 		}
@@ -235,11 +291,20 @@ func (r *Results) makeResultTXT(b []byte, p par) []byte {
 		} else {
 			b = wF(b, "\tAir density (kg/m^3)    ", r.Rho, d3, le)
 		}
+		if segmentRho(p) {
+			b = wF(b, "\tSegment air density min ", r.RhoMin, d3, le)
+			b = wF(b, "\t    max                 ", r.RhoMax, d3, le)
+		}
 		if p.Environment.AirDensity < 0 {
 			b = wI(b, "\tBase elevation (m)      ", r.BaseElevation, le)
 			b = wF(b, "\t    temperature (C)     ", p.Environment.Temperature, d1, le)
 			b = wF(b, "\t    air density (kg/m^3)", r.RhoBase, d3, le)
 			b = wF(b, "\t    air pressure (hPa)  ", r.AirPressure, d2, le)
+			if p.Environment.MoistAir != 1 {
+				b = wI(b, "\t    rel. humidity (%)   ", p.Environment.RelativeHumidity, le)
+				b = wF(b, "\t    dew point (C)       ", p.Environment.DewPoint, d1, le)
+				b = wF(b, "\t    moist/dry air rho   ", p.Environment.MoistAir, d4, le)
+			}
 		}
 		return b
 	}
@@ -312,6 +377,9 @@ func (r *Results) makeResultTXT(b []byte, p par) []byte {
 		b = wF(b, "\tBraking          ", r.DistBrake, d1, le)
 		b = wF(b, "\tFreewheeling     ", r.DistFreewheel, d1, le)
 		b = wF(b, "\tRider powered    ", r.DistRider, d1, le)
+		if walking(p) {
+			b = wF(b, "\tWalked           ", r.DistWalk, d2, le)
+		}
 		return b
 	}
 	speed := func(b []byte) []byte {
@@ -326,7 +394,22 @@ func (r *Results) makeResultTXT(b []byte, p par) []byte {
 	drivingtime := func(b []byte) []byte {
 		b = wF(b, le+"Driving time (h)       \t", r.Time, d2, le)
 		b = wF(b, "\tFrom target speeds     ", r.TimeTargetSpeeds, d2, le)
+		if yawDrag(p) {
+			b = wF(b, "\t    lost to crosswinds ", r.TimeCrosswind, d2, le)
+		}
+		if segmentRho(p) {
+			b = wF(b, "\t    segment air density", r.TimeSegmentRho, d3, le)
+		}
+		if altitudePower(p) {
+			b = wF(b, "\t    lost to altitude   ", r.TimeAltitude, d2, le)
+		}
+		if fatigue(p) {
+			b = wF(b, "\t    lost to fatigue    ", r.TimeFatigue, d2, le)
+		}
 		b = wF(b, "\tPedal powered          ", r.TimeRider, d2, le)
+		if walking(p) {
+			b = wF(b, "\tWalked                 ", r.TimeWalk, d2, le)
+		}
 		b = wF(b, "\tBraking                ", r.TimeBraking, d2, le)
 		b = wF(b, "\tFreewheeling           ", r.TimeFreewheel, d2, le)
 		if r.TimeUHBreaks > 0 {
@@ -342,17 +425,185 @@ func (r *Results) makeResultTXT(b []byte, p par) []byte {
 		b = wF(b, "\tOver flat ground power ", r.TimeOverFlatPower, d2, le)
 		return b
 	}
+	clocktimes := func(b []byte) []byte {
+		b = append(b, le+"Clock times"+le...)
+		if p.Ride.StartTime != "" {
+			b = wS(b, "\tStart                  ", r.StartClock, le)
+			b = wS(b, "\tFinish                 ", r.FinishClock, le)
+			b = wF(b, "\tUTC offset (h)         ", r.UTCOffset, d1, le)
+			b = wS(b, "\tSunrise                ", r.Sunrise, le)
+			b = wS(b, "\tSunset                 ", r.Sunset, le)
+			if r.TimeDark > 0 {
+				b = wF(b, "\tRiding in the dark (h) ", r.TimeDark, d2, le)
+			}
+		}
+		if len(r.Waypoints) == 0 {
+			return b
+		}
+		b = append(b, le+"\tWaypoint\t  km\t   h"...)
+		if p.Ride.StartTime != "" {
+			b = append(b, "\tarrival"...)
+		}
+		b = append(b, le...)
+		for _, w := range r.Waypoints {
+			b = append(b, "\t"+w.Name+"\t"...)
+			b = numconv.Ftoa(b, w.Dist, d1, '\t')
+			b = append(b, hhmm(w.Time)...)
+			if w.Arrival != "" {
+				b = append(b, "\t"+w.Arrival...)
+			}
+			b = append(b, le...)
+		}
+		return b
+	}
+	reststops := func(b []byte) []byte {
+		b = append(b, le+"Rest stops"+le...)
+		b = wF(b, "\tMoving time (h)        ", r.Time, d2, le)
+		b = wF(b, "\tUphill break time (h)  ", r.TimeUHBreaks, d2, le)
+		b = wF(b, "\tRest stop time (h)     ", r.TimeStops, d2, le)
+		b = wF(b, "\tElapsed time (h)       ", r.TimeElapsed, d2, le)
+		b = append(b, le+"\tStop at km\t   h\t min\tmeal\twaypoint"+le...)
+		for _, st := range r.Stops {
+			b = append(b, '\t')
+			b = numconv.Ftoa(b, st.Dist, d1, '\t')
+			b = append(b, hhmm(st.Time)...)
+			b = append(b, '\t')
+			b = numconv.Ftoa(b, st.Duration, 0, '\t')
+			if st.Meal {
+				b = append(b, "meal"...)
+			}
+			b = append(b, '\t')
+			b = append(b, st.Waypoint...)
+			b = append(b, le...)
+		}
+		return b
+	}
+	gears := func(b []byte) []byte {
+		b = append(b, le+"Gearing"+le...)
+		b = wF(b, "\tLowest gear speed (km/h)   ", r.GearLowSpeed, d1, le)
+		b = wF(b, "\tTop gear speed (km/h)      ", r.GearTopSpeed, d1, le)
+		b = wF(b, "\tMax grade lowest gear (%)  ", r.MaxGradeLowGear, d1, le)
+		b = wI(b, "\tUndergeared segments       ", float64(r.SegmentsUndergeared), le)
+		b = wF(b, "\tUndergeared distance (km)  ", r.DistUndergeared, d2, le)
+		b = append(b, le+"\tGrade %\tmin km/h\tpower W\tmax km/h"+le...)
+		for _, x := range r.ClimbSpeeds {
+			b = append(b, '\t')
+			b = numconv.Ftoa(b, x.Grade, 0, '\t')
+			b = numconv.Ftoa(b, x.MinSpeed, d1, '\t')
+			b = numconv.Ftoa(b, x.Power, 0, '\t')
+			b = numconv.Ftoa(b, x.MaxSpeed, d1, '\t')
+			b = append(b, le...)
+		}
+		return b
+	}
+	motorbattery := func(b []byte) []byte {
+		q := p.Ebike
+		b = append(b, le+"E-bike"+le...)
+		b = wI(b, "\tAssist (%)                 ", q.Assist, le)
+		b = wI(b, "\tMax motor power (W)        ", q.MaxPower, le)
+		b = wF(b, "\tAssist cutoff speed (km/h) ", q.CutoffSpeed, d1, le)
+		b = wI(b, "\tMotor energy (Wh)          ", r.Jmotor, le)
+		if regen(p) {
+			b = wI(b, "\tRegenerated (Wh)           ", -r.Jregen, le)
+		}
+		b = wI(b, "\tBattery used (Wh)          ", r.JbatteryUsed, le)
+		b = wI(b, "\tBattery used (%)           ", r.BatteryUsedPros, le)
+		b = wI(b, "\tBattery left (Wh)          ", r.JbatteryLeft, le)
+		b = wF(b, "\tRange left (km)            ", r.RangeLeft, d1, le)
+		if r.BatteryEmptyAt > 0 {
+			b = wF(b, "\tBattery empty at (km)      ", r.BatteryEmptyAt, d1, le)
+		}
+		return b
+	}
+	histogram := func(b []byte, title string, h *Histogram) []byte {
+		b = append(b, le+title+"\t   h\t  km\t  Wh"+le...)
+		for i := range h.Time {
+			b = append(b, '\t')
+			switch {
+			case len(h.Limits) == 0:
+				b = append(b, "all"...)
+			case i == 0:
+				b = append(b, "< "...)
+				b = numconv.Ftoa(b, h.Limits[0], 0, 0)
+			case i == len(h.Limits):
+				b = append(b, ">= "...)
+				b = numconv.Ftoa(b, h.Limits[i-1], 0, 0)
+			default:
+				b = numconv.Ftoa(b, h.Limits[i-1], 0, ' ')
+				b = append(b, "- "...)
+				b = numconv.Ftoa(b, h.Limits[i], 0, 0)
+			}
+			b = append(b, '\t')
+			b = numconv.Ftoa(b, h.Time[i], d2, '\t')
+			b = numconv.Ftoa(b, h.Dist[i], d1, '\t')
+			b = numconv.Ftoa(b, h.Energy[i], 0, 0)
+			b = append(b, le...)
+		}
+		return b
+	}
+	speedschedule := func(b []byte) []byte {
+		b = append(b, le+"Speed schedule pacing"+le...)
+		b = append(b, "\tgrade (%)\t km/h\t   W"+le...)
+		for _, sp := range r.SpeedSchedule {
+			b = append(b, '\t')
+			b = numconv.Ftoa(b, sp.Grade, d1, '\t')
+			b = numconv.Ftoa(b, sp.Speed, d1, '\t')
+			b = numconv.Ftoa(b, sp.Power, 0, ' ')
+			b = append(b, le...)
+		}
+		return b
+	}
 	// Joules below are converted to Wh before
 	energyrider := func(b []byte) []byte {
 		b = wI(b, le+"Energy rider (Wh)          \t", r.JriderTotal, le)
 		b = wI(b, "\tFrom target powers (Wh)  ", r.JfromTargetPower, le)
+		if walking(p) {
+			b = wI(b, "\tWalking (Wh)             ", r.JriderWalk, le)
+		}
 		b = wI(b, "\tFood (kcal)              ", r.FoodRider, le)
-		b = wI(b, "\tBananas (pcs)            ", r.BananaRider, le)
-		b = wI(b, "\tLard (g)                 ", r.FatRider, le)
+		for _, f := range r.Foods {
+			name := f.Name + " (" + f.Unit + ")"
+			name += strings.Repeat(" ", max(0, 25-len(name)))
+			b = wI(b, "\t"+name, f.Amount, le)
+		}
 		b = wI(b, "\tAverage power (W)        ", r.PowerRiderAvg, le)
 		b = wF(b, "\tEnergy/distance (Wh/km)  ", r.JriderTotal/r.DistTotal, d2, le)
 		return b
 	}
+	nutritionplan := func(b []byte) []byte {
+		b = append(b, le+"Nutrition plan"+le...)
+		b = wI(b, "\tCarbohydrates (g)        ", r.Carbs, le)
+		b = wF(b, "\tFluid (l)                ", r.Fluid, d1, le)
+		b = wF(b, "\tCarried load (kg)        ", r.CarriedLoad, d1, le)
+		b = wF(b, "\tWater resupply (l)       ", r.WaterResupply, d1, le)
+		b = append(b, le+"\tFeed at km\t   h\tcarbs g\tfluid l\twaypoint"+le...)
+		for _, f := range r.Feeds {
+			b = append(b, "\t"...)
+			b = numconv.Ftoa(b, f.Dist, d1, '\t')
+			b = append(b, hhmm(f.Time)...)
+			b = append(b, '\t')
+			b = numconv.Ftoa(b, f.Carbs, 0, '\t')
+			b = numconv.Ftoa(b, f.Fluid, d2, '\t')
+			b = append(b, f.Waypoint...)
+			b = append(b, le...)
+		}
+		return b
+	}
+	groupride := func(b []byte) []byte {
+		g := p.Group
+		b = append(b, le+"Group ride"+le...)
+		b = wI(b, "\tGroup size               ", float64(g.Size), le)
+		b = wI(b, "\tPull fraction (%)        ", g.PullFraction, le)
+		b = wI(b, "\tDraft CdA (%)            ", g.DraftCdA, le)
+		b = wI(b, "\tRider energy (Wh)        ", r.JriderFront+r.JriderDraft, le)
+		b = wI(b, "\t    front (Wh)           ", r.JriderFront, le)
+		b = wI(b, "\t    sheltered (Wh)       ", r.JriderDraft, le)
+		b = wF(b, "\tFront time (h)           ", r.TimeFront, d2, le)
+		b = wF(b, "\tSheltered time (h)       ", r.TimeDraft, d2, le)
+		b = wF(b, "\tFront distance (km)      ", r.DistFront, d1, le)
+		b = wF(b, "\tSheltered distance (km)  ", r.DistDraft, d1, le)
+		return b
+	}
 
 	riderenergyusage := func(b []byte) []byte {
 		c := 100.0 / r.JriderTotal
@@ -378,6 +629,9 @@ func (r *Results) makeResultTXT(b []byte, p par) []byte {
 	totalenergybalance := func(b []byte) []byte {
 		b = append(b, le+"Total energy balance (Wh)"+le...)
 		b = wI(b, "\tRider               ", r.JriderTotal, le)
+		if ebike(p) {
+			b = wI(b, "\tMotor               ", r.Jmotor, le)
+		}
 		b = wI(b, "\tDrivetrain loss     ", -r.JlossDT, le)
 		b = wF(b, "\tKinetic resistance  ", r.JkineticAcce, d1, le)
 		b = wF(b, "\tKinetic push        ", r.JkineticDece, d1, le)
@@ -394,8 +648,11 @@ func (r *Results) makeResultTXT(b []byte, p par) []byte {
 		}
 		b = wI(b, "\tRolling resistance  ", r.Jroll, le)
 		b = wI(b, "\tBraking             ", r.Jbraking, le)
+		if regen(p) {
+			b = wI(b, "\tRegeneration        ", r.Jregen, le)
+		}
 		// b = wF(b, "\n\tEnergy net error (Wh)", r.EnergySumTotal, d2, le)
-		plusEnergy := r.JriderTotal + r.JkineticDece + r.JgravDown + r.JdragPush
+		plusEnergy := r.JriderTotal + r.Jmotor + r.JkineticDece + r.JgravDown + r.JdragPush
 		b = wF(b, "\n\tEnergy net error (%)", 100*r.EnergySumTotal/plusEnergy, d3, le)
 		return b
 	}
@@ -418,6 +675,15 @@ func (r *Results) makeResultTXT(b []byte, p par) []byte {
 			b = numconv.Ftoa(b, p.Ride.MinSpeed, d1, 0)
 			b = append(b, " km/h)"+le...)
 		}
+		if altitudePower(p) {
+			b = wI(b, "\tMin altitude power (%)    ", r.AltitudePowerMin, le)
+		}
+		if fatigue(p) {
+			b = wI(b, "\tCritical power (W)         ", p.Fatigue.CP, le)
+			b = wF(b, "\tW' (kJ)                    ", p.Fatigue.WPrime, d1, le)
+			b = wF(b, "\tMin W' balance (kJ)        ", r.WPrimeMin, d1, le)
+			b = wF(b, "\tEnd W' balance (kJ)        ", r.WPrimeEnd, d1, le)
+		}
 		b = append(b, " "+le...)
 		b = wF(b, "\tMax pedaled speed (km/h)  ", q.MaxPedaledSpeed, d1, le)
 		b = wF(b, "\tMin pedaled grade (%)     ", q.MinPedaledGrade, d2, "\t(")
@@ -526,9 +792,39 @@ func (r *Results) makeResultTXT(b []byte, p par) []byte {
 	b = distance(b)
 	b = speed(b)
 	b = drivingtime(b)
+	if p.Ride.StartTime != "" || len(r.Waypoints) > 0 {
+		b = clocktimes(b)
+	}
+	if restStops(p) {
+		b = reststops(b)
+	}
 	b = energyrider(b)
+	if nutrition(p) {
+		b = nutritionplan(b)
+	}
+	if groupRide(p) {
+		b = groupride(b)
+	}
 	b = riderenergyusage(b)
 	b = rider(b)
+	if len(r.SpeedSchedule) > 0 {
+		b = speedschedule(b)
+	}
+	if gearing(p) {
+		b = gears(b)
+	}
+	if ebike(p) {
+		b = motorbattery(b)
+	}
+	if r.PowerZones != nil {
+		b = histogram(b, "Power zones (% FTP)", r.PowerZones)
+	}
+	if r.SpeedBands != nil {
+		b = histogram(b, "Speed bands (km/h)", r.SpeedBands)
+	}
+	if r.GradeBands != nil {
+		b = histogram(b, "Grade bands (%)", r.GradeBands)
+	}
 	b = totalenergybalance(b)
 	if p.ReportTech {
 		b = technical(b)
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"errors"
 	"strconv"
 
 	"github.com/pekkizen/bikeride/logerr"
 	"github.com/pekkizen/bikeride/param"
 	"github.com/pekkizen/bikeride/power"
 	"github.com/pekkizen/bikeride/route"
+	"github.com/pekkizen/bikeride/weather"
 
 	"github.com/pekkizen/motion"
 )
@@ -21,11 +23,34 @@ func setupSystem(c *motion.BikeCalc, m *power.Generator, p *param.Parameters,
 	if err := setupParameters(p, c, l); err != nil {
 		return err
 	}
-	setupPowerModel(m, p)
+	if err := setupPowerModel(m, p); err != nil {
+		return l.Errorf("Power ratio table: %v", err)
+	}
 	l.SetPrefix("")
 	return nil
 }
 
+// readForecast reads the wind forecast file, if given.
+func readForecast(p *param.Parameters) (*weather.Forecast, error) {
+	if p.Environment.WindForecast == "" {
+		return nil, nil
+	}
+	f, e := weather.ReadForecast(p.Environment.WindForecast)
+	if e != nil {
+		return nil, e
+	}
+	f.SetStart(p.Ride.Start)
+	return f, nil
+}
+
+// readWindField reads the wind field file, if given.
+func readWindField(p *param.Parameters) (*weather.WindField, error) {
+	if p.Environment.WindField == "" {
+		return nil, nil
+	}
+	return weather.ReadWindField(p.Environment.WindField)
+}
+
 func setupCalculator(c *motion.BikeCalc, o *route.Route, p *param.Parameters) {
 	b := &p.Bike
 	e := &p.Environment
@@ -42,7 +67,8 @@ func setupCalculator(c *motion.BikeCalc, o *route.Route, p *param.Parameters) {
 	c.SetVelErrors(p.VelErrors)
 	if p.VelSolver < 1 {
 		p.VelSolver = motion.NewtonRaphsonM
-		if p.Environment.WindSpeed == 0 {
+		if p.Environment.WindSpeed == 0 && p.Environment.WindForecast == "" &&
+			p.Environment.WindField == "" {
 			p.VelSolver = motion.Householder3M
 		}
 	}
@@ -79,16 +105,49 @@ func setupCalculator(c *motion.BikeCalc, o *route.Route, p *param.Parameters) {
 	// RhoFromEle uses base elevation, temperature, air pressure and gravity
 	// to calculate air density and temperature at elevation EleMean.
 	o.Rho, o.Temperature = c.RhoFromEle(o.EleMean)
+	setHumidity(p)
+	o.Rho *= e.MoistAir
 	c.SetRho(o.Rho)
 }
 
-func setupPowerModel(m *power.Generator, p *param.Parameters) {
+// setHumidity sets the moist air density ratio from the base elevation
+// relative humidity or dew point, and the missing one of them. The water
+// vapor mixing ratio is taken as constant, so the ratio is the same at all
+// elevations. Relative humidity 0 is dry air and has no dew point.
+func setHumidity(p *param.Parameters) {
+	var (
+		e  = &p.Environment
+		pv float64
+	)
+	switch {
+	case e.RelativeHumidity >= 0:
+		pv = e.RelativeHumidity / 100 * weather.SaturationPressure(e.Temperature)
+		if pv <= 0 {
+			return
+		}
+		e.DewPoint = weather.DewPoint(pv)
+	case e.DewPointGiven():
+		pv = weather.SaturationPressure(e.DewPoint)
+		e.RelativeHumidity = 100 * pv / weather.SaturationPressure(e.Temperature)
+	default:
+		return
+	}
+	e.MoistAir = weather.MoistAirRatio(pv, e.AirPressure)
+}
+
+func setupPowerModel(m *power.Generator, p *param.Parameters) error {
 	q := &p.Powermodel
 
 	m.SysGradeUp(q.UphillPowerGrade)
 	m.SysGradeDown(q.DownhillPowerGrade)
 	m.SysTailwind(q.SysTailwind)
 	m.SysHeadwind(q.SysHeadwind)
+	if q.ExpUphill > 0 {
+		m.ExpUphill(q.ExpUphill)
+	}
+	if q.ExpDownhill > 0 {
+		m.ExpDownhill(q.ExpDownhill)
+	}
 	m.PowerTailRatio(q.TailWindPower / 100)
 	m.PowerHeadRatio(q.HeadWindPower / 100)
 	m.PowerUpRatio(q.UphillPower / q.FlatPower)
@@ -114,8 +173,23 @@ func setupPowerModel(m *power.Generator, p *param.Parameters) {
 	if q.CDH > 0 {
 		m.CDH(q.CDH)
 	}
+	if q.RatioTableFile != "" && q.PowermodelType == 5 {
+		t, err := power.ReadRatioTable(q.RatioTableFile)
+		if err != nil {
+			return err
+		}
+		m.SetRatioTable(t)
+	}
+	if q.PowermodelType == 6 {
+		t, err := power.NewSpeedSchedule(q.SpeedSchedule.Grade, q.SpeedSchedule.Wind, q.SpeedSchedule.Speed)
+		if err != nil {
+			return errors.New("speedSchedule: " + err.Error())
+		}
+		m.SetSpeedSchedule(t)
+	}
 	m.PowerModelType(q.PowermodelType)
 	m.Setup() //must be done
+	return nil
 }
 
 func setupParameters(p *param.Parameters,
@@ -150,6 +224,11 @@ func setupParameters(p *param.Parameters,
 	if e := uphillPowerGradeSpeed(p, c, l); e != nil {
 		return e
 	}
+	if _, top := route.GearSpeedRange(p); top > 0 && top < p.Powermodel.MaxPedaledSpeed {
+		l.Msg(0, "maxPedaledSpeed", ftoa(p.Powermodel.MaxPedaledSpeed*ms2kmh, 1),
+			"km/h lowered to the top gear speed", ftoa(top*ms2kmh, 1), "km/h")
+		p.Powermodel.MaxPedaledSpeed = top // top gear at max cadence
+	}
 	if e := maxPedaledSpeed(p, c); e != nil {
 		return e
 	}
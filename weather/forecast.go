@@ -0,0 +1,299 @@
+// Package weather reads local weather data files for the ride calculation.
+package weather
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	π       = math.Pi
+	deg2rad = π / 180
+	rad2deg = 180 / π
+)
+
+var errf = fmt.Errorf
+
+// Record is a single forecast time point. Wind course is the compass
+// direction the wind comes from, as windCourse in ride.json.
+type Record struct {
+	Time        time.Time
+	WindCourse  float64 // deg
+	WindSpeed   float64 // m/s
+	Temperature float64 // C
+	AirPressure float64 // hPa
+}
+
+// Forecast is an hourly (or any interval) weather forecast for the ride.
+// The times of the ride calculation are seconds from the ride start time.
+type Forecast struct {
+	records     []Record
+	start       time.Time
+	temperature bool // all records have temperature
+	airPressure bool // all records have air pressure
+}
+
+type jsonRecord struct {
+	Time        string   `json:"time"`
+	WindCourse  float64  `json:"windCourse (deg)"`
+	WindSpeed   float64  `json:"windSpeed (m/s)"`
+	Temperature *float64 `json:"temperature (C)"`
+	AirPressure *float64 `json:"airPressure (hPa)"`
+}
+
+// timeLayouts are the accepted time formats. Times without a time zone
+// are taken as UTC. All times must be given in the same local time
+// as the ride start time.
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+// ParseTime parses a time in one of the accepted formats. The ride start
+// time is parsed by it too.
+func ParseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errf("unknown time format %q", s)
+}
+
+// ReadForecast reads a forecast file. Files with extension .json are read as
+// a JSON array of records
+//
+//	[{"time": "2024-05-18 08:00", "windCourse (deg)": 250, "windSpeed (m/s)": 4.5,
+//	  "temperature (C)": 17, "airPressure (hPa)": 1012}, ...]
+//
+// and other files as CSV with a header line
+//
+//	time,windCourse,windSpeed,temperature,airPressure
+//
+// Temperature and air pressure are optional. The CSV separator may be
+// a comma, a semicolon or a tab.
+func ReadForecast(file string) (*Forecast, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errf("%v", err)
+	}
+	f := &Forecast{}
+	if strings.HasSuffix(strings.ToLower(file), ".json") {
+		err = f.parseJSON(data)
+	} else {
+		err = f.parseCSV(data)
+	}
+	if err != nil {
+		return nil, errf("%s: %v", file, err)
+	}
+	if len(f.records) == 0 {
+		return nil, errf("%s: no forecast records", file)
+	}
+	sort.SliceStable(f.records, func(i, j int) bool {
+		return f.records[i].Time.Before(f.records[j].Time)
+	})
+	f.start = f.records[0].Time
+	return f, nil
+}
+
+func (f *Forecast) parseJSON(data []byte) error {
+	var recs []jsonRecord
+	if err := json.Unmarshal(data, &recs); err != nil {
+		return err
+	}
+	f.temperature, f.airPressure = true, true
+	for i, r := range recs {
+		t, err := ParseTime(r.Time)
+		if err != nil {
+			return errf("record %d: %v", i+1, err)
+		}
+		rec := Record{Time: t, WindCourse: r.WindCourse, WindSpeed: r.WindSpeed}
+		if r.Temperature != nil {
+			rec.Temperature = *r.Temperature
+		} else {
+			f.temperature = false
+		}
+		if r.AirPressure != nil {
+			rec.AirPressure = *r.AirPressure
+		} else {
+			f.airPressure = false
+		}
+		f.records = append(f.records, rec)
+	}
+	return nil
+}
+
+// csvColumns maps the header names to record fields. Units in
+// parenthesis, case and spaces are ignored: "Wind Speed (m/s)" is windspeed.
+var csvColumns = map[string]int{
+	"time":        0,
+	"windcourse":  1,
+	"direction":   1,
+	"windspeed":   2,
+	"speed":       2,
+	"temperature": 3,
+	"airpressure": 4,
+	"pressure":    4,
+}
+
+func columnName(s string) string {
+	if i := strings.IndexByte(s, '('); i >= 0 {
+		s = s[:i]
+	}
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(s), " ", ""))
+}
+
+func (f *Forecast) parseCSV(data []byte) error {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = csvSeparator(data)
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(rows) < 2 {
+		return errf("header line and at least one data line needed")
+	}
+	col := [5]int{-1, -1, -1, -1, -1}
+	for i, name := range rows[0] {
+		if k, ok := csvColumns[columnName(name)]; ok {
+			col[k] = i
+		}
+	}
+	if col[0] < 0 || col[1] < 0 || col[2] < 0 {
+		return errf("header must have columns time, windCourse and windSpeed")
+	}
+	f.temperature = col[3] >= 0
+	f.airPressure = col[4] >= 0
+
+	for i, row := range rows[1:] {
+		var x [5]float64
+		for k := 1; k < len(col); k++ {
+			if col[k] < 0 {
+				continue
+			}
+			if col[k] >= len(row) {
+				return errf("line %d: missing column", i+2)
+			}
+			if x[k], err = strconv.ParseFloat(strings.TrimSpace(row[col[k]]), 64); err != nil {
+				return errf("line %d: %v", i+2, err)
+			}
+		}
+		t, err := ParseTime(row[col[0]])
+		if err != nil {
+			return errf("line %d: %v", i+2, err)
+		}
+		f.records = append(f.records, Record{t, x[1], x[2], x[3], x[4]})
+	}
+	return nil
+}
+
+func csvSeparator(data []byte) rune {
+	line := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		line = data[:i]
+	}
+	switch {
+	case bytes.IndexByte(line, '\t') >= 0:
+		return '\t'
+	case bytes.IndexByte(line, ';') >= 0:
+		return ';'
+	}
+	return ','
+}
+
+// SetStart sets the ride start time. Forecast values are asked by
+// seconds from the start time.
+func (f *Forecast) SetStart(t time.Time) { f.start = t }
+
+// Len returns the number of forecast records.
+func (f *Forecast) Len() int { return len(f.records) }
+
+// Covers reports whether the forecast covers the time span of sec seconds
+// from the ride start.
+func (f *Forecast) Covers(sec float64) bool {
+	first, last := f.records[0].Time, f.records[len(f.records)-1].Time
+	end := f.start.Add(time.Duration(sec * float64(time.Second)))
+	return !f.start.Before(first) && !end.After(last)
+}
+
+// at returns the index i and the weight w of the linear interpolation
+// between records i and i+1 at sec seconds from the ride start.
+// Outside the forecast the first or the last record is used.
+func (f *Forecast) at(sec float64) (i int, w float64) {
+	var (
+		r = f.records
+		t = f.start.Add(time.Duration(sec * float64(time.Second)))
+	)
+	i = sort.Search(len(r), func(k int) bool { return r[k].Time.After(t) }) - 1
+	if i < 0 {
+		return 0, 0
+	}
+	if i >= len(r)-1 {
+		return len(r) - 1, 0
+	}
+	w = float64(t.Sub(r[i].Time)) / float64(r[i+1].Time.Sub(r[i].Time))
+	return i, w
+}
+
+// Wind returns the wind course (deg) and speed (m/s) at sec seconds from
+// the ride start. Wind vectors are interpolated, not courses and speeds,
+// so a turning wind turns through the shorter way.
+func (f *Forecast) Wind(sec float64) (course, speed float64) {
+	i, w := f.at(sec)
+	r0 := &f.records[i]
+	if w == 0 {
+		return r0.WindCourse, r0.WindSpeed
+	}
+	r1 := &f.records[i+1]
+	s0, c0 := math.Sincos(r0.WindCourse * deg2rad)
+	s1, c1 := math.Sincos(r1.WindCourse * deg2rad)
+	x := (1-w)*r0.WindSpeed*s0 + w*r1.WindSpeed*s1
+	y := (1-w)*r0.WindSpeed*c0 + w*r1.WindSpeed*c1
+
+	speed = math.Sqrt(x*x + y*y)
+	course = math.Atan2(x, y) * rad2deg
+	if course < 0 {
+		course += 360
+	}
+	return course, speed
+}
+
+// Temperature returns the temperature (C) at sec seconds from the ride
+// start. ok is false if the forecast has no temperatures.
+func (f *Forecast) Temperature(sec float64) (temp float64, ok bool) {
+	if !f.temperature {
+		return 0, false
+	}
+	i, w := f.at(sec)
+	if w == 0 {
+		return f.records[i].Temperature, true
+	}
+	return (1-w)*f.records[i].Temperature + w*f.records[i+1].Temperature, true
+}
+
+// AirPressure returns the air pressure (hPa) at sec seconds from the ride
+// start. ok is false if the forecast has no air pressures.
+func (f *Forecast) AirPressure(sec float64) (pressure float64, ok bool) {
+	if !f.airPressure {
+		return 0, false
+	}
+	i, w := f.at(sec)
+	if w == 0 {
+		return f.records[i].AirPressure, true
+	}
+	return (1-w)*f.records[i].AirPressure + w*f.records[i+1].AirPressure, true
+}
@@ -0,0 +1,69 @@
+package weather
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestReadForecastCSV(t *testing.T) {
+	file := writeFile(t, "fc.csv", "time;windCourse (deg);windSpeed (m/s);temperature (C)\n"+
+		"2024-05-18 09:00;90;4;18\n"+
+		"2024-05-18 08:00;0;4;12\n")
+	f, err := ReadForecast(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Len() != 2 {
+		t.Fatalf("records %d, want 2", f.Len())
+	}
+	f.SetStart(time.Date(2024, 5, 18, 8, 0, 0, 0, time.UTC))
+
+	course, speed := f.Wind(1800)
+	if math.Abs(course-45) > 1e-9 || math.Abs(speed-4*math.Sqrt(0.5)) > 1e-9 {
+		t.Errorf("half hour wind %.3f deg %.3f m/s", course, speed)
+	}
+	if temp, ok := f.Temperature(1800); !ok || math.Abs(temp-15) > 1e-9 {
+		t.Errorf("half hour temperature %.3f %v", temp, ok)
+	}
+	if _, ok := f.AirPressure(0); ok {
+		t.Errorf("air pressure without column")
+	}
+	if course, _ := f.Wind(5 * 3600); course != 90 {
+		t.Errorf("wind after forecast end %.3f, want 90", course)
+	}
+	if f.Covers(2*3600) || !f.Covers(3600) {
+		t.Errorf("Covers")
+	}
+}
+
+func TestReadForecastJSON(t *testing.T) {
+	file := writeFile(t, "fc.json", `[
+		{"time": "2024-05-18T08:00", "windCourse (deg)": 350, "windSpeed (m/s)": 2},
+		{"time": "2024-05-18T10:00", "windCourse (deg)": 10, "windSpeed (m/s)": 2}]`)
+	f, err := ReadForecast(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	course, speed := f.Wind(3600) // turns through north, not south
+	if math.Abs(course) > 1e-9 && math.Abs(course-360) > 1e-9 {
+		t.Errorf("course %.3f, want 0", course)
+	}
+	if math.Abs(speed-2*math.Cos(10*deg2rad)) > 1e-9 {
+		t.Errorf("speed %.3f", speed)
+	}
+	if _, ok := f.Temperature(0); ok {
+		t.Errorf("temperature without values")
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/pekkizen/bikeride/weather
+
+go 1.22.0
@@ -0,0 +1,44 @@
+// Package grid interpolates tables on rectilinear grids. It is used by the
+// wind fields and the power ratio and speed tables.
+package grid
+
+import "sort"
+
+// Increasing reports whether the grid axis s is in increasing order.
+func Increasing(s []float64) bool {
+	for i := 1; i < len(s); i++ {
+		if s[i] <= s[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// Cell returns the grid index i and the interpolation weight t of x on
+// the grid axis s. Outside the grid the nearest edge value is used.
+func Cell(s []float64, x float64) (i int, t float64) {
+	if len(s) == 1 || x <= s[0] {
+		return 0, 0
+	}
+	if x >= s[len(s)-1] {
+		return len(s) - 2, 1
+	}
+	i = sort.SearchFloat64s(s, x) - 1
+	return i, (x - s[i]) / (s[i+1] - s[i])
+}
+
+// Bilinear returns z bilinearly interpolated in the cell i, j with the
+// weights ti and tj given by Cell.
+func Bilinear(z [][]float64, i, j int, ti, tj float64) float64 {
+	i1, j1 := min(i+1, len(z)-1), min(j+1, len(z[0])-1)
+	z0 := z[i][j] + tj*(z[i][j1]-z[i][j])
+	z1 := z[i1][j] + tj*(z[i1][j1]-z[i1][j])
+	return z0 + ti*(z1-z0)
+}
+
+// At returns z bilinearly interpolated at x and y on the grid axes xs and ys.
+func At(xs, ys []float64, z [][]float64, x, y float64) float64 {
+	i, ti := Cell(xs, x)
+	j, tj := Cell(ys, y)
+	return Bilinear(z, i, j, ti, tj)
+}
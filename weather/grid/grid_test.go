@@ -0,0 +1,42 @@
+package grid
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCell(t *testing.T) {
+	s := []float64{0, 10, 20}
+	for _, tc := range []struct {
+		x  float64
+		i  int
+		ti float64
+	}{{-5, 0, 0}, {0, 0, 0}, {5, 0, 0.5}, {10, 0, 1}, {12, 1, 0.2}, {25, 1, 1}} {
+		if i, ti := Cell(s, tc.x); i != tc.i || math.Abs(ti-tc.ti) > 1e-12 {
+			t.Errorf("Cell(%g) = %d, %g, want %d, %g", tc.x, i, ti, tc.i, tc.ti)
+		}
+	}
+	if i, ti := Cell([]float64{3}, 5); i != 0 || ti != 0 {
+		t.Errorf("one point Cell = %d, %g", i, ti)
+	}
+}
+
+func TestAt(t *testing.T) {
+	xs, ys := []float64{0, 1}, []float64{0, 2, 4}
+	z := [][]float64{{0, 2, 4}, {1, 3, 5}} // x + y
+	for _, p := range [][2]float64{{0.5, 1}, {0.25, 3}, {1, 4}, {-1, 5}} {
+		want := min(max(p[0], 0), 1) + min(max(p[1], 0), 4)
+		if got := At(xs, ys, z, p[0], p[1]); math.Abs(got-want) > 1e-12 {
+			t.Errorf("At(%g, %g) = %g, want %g", p[0], p[1], got, want)
+		}
+	}
+	if got := At(xs, []float64{0}, [][]float64{{2}, {4}}, 0.5, 7); got != 3 {
+		t.Errorf("one column At = %g, want 3", got)
+	}
+}
+
+func TestIncreasing(t *testing.T) {
+	if !Increasing([]float64{1, 2, 3}) || Increasing([]float64{1, 1}) || !Increasing(nil) {
+		t.Error("Increasing")
+	}
+}
@@ -0,0 +1,22 @@
+package weather
+
+import "math"
+
+// SaturationPressure returns the saturation water vapor pressure (hPa) at
+// temperature temp (C) by the Magnus formula.
+func SaturationPressure(temp float64) float64 {
+	return 6.1094 * math.Exp(17.625*temp/(temp+243.04))
+}
+
+// DewPoint returns the dew point (C) of water vapor pressure pv (hPa).
+func DewPoint(pv float64) float64 {
+	x := math.Log(pv / 6.1094)
+	return 243.04 * x / (17.625 - x)
+}
+
+// MoistAirRatio returns the ratio of moist air density to dry air density
+// at the same total pressure p and temperature, for water vapor pressure pv.
+// Water vapor is lighter than dry air: rho = rhoDry * (1 - 0.378 * pv/p).
+func MoistAirRatio(pv, p float64) float64 {
+	return 1 - 0.378*pv/p
+}
@@ -0,0 +1,18 @@
+package weather
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHumidity(t *testing.T) {
+	if pv := SaturationPressure(20); math.Abs(pv-23.37) > 0.05 {
+		t.Errorf("saturation pressure at 20 C %.2f hPa, want 23.37", pv)
+	}
+	if dp := DewPoint(SaturationPressure(12)); math.Abs(dp-12) > 1e-9 {
+		t.Errorf("dew point %.6f, want 12", dp)
+	}
+	if r := MoistAirRatio(23.37, 1013.25); math.Abs(r-0.99128) > 1e-5 {
+		t.Errorf("moist air ratio %.5f", r)
+	}
+}
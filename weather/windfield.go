@@ -0,0 +1,174 @@
+package weather
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pekkizen/bikeride/weather/grid"
+)
+
+// WindField is a gridded wind field. u is the eastward and v the northward
+// component (m/s) of the air movement, as in weather models. u[i][j] and
+// v[i][j] are the components at latitude lat[i] and longitude lon[j].
+// Latitudes and longitudes are in increasing order.
+type WindField struct {
+	lat []float64
+	lon []float64
+	u   [][]float64
+	v   [][]float64
+}
+
+type jsonWindField struct {
+	Lat []float64   `json:"lat"`
+	Lon []float64   `json:"lon"`
+	U   [][]float64 `json:"u (m/s)"`
+	V   [][]float64 `json:"v (m/s)"`
+}
+
+// ReadWindField reads a wind field file. Files with extension .json are read as
+//
+//	{"lat": [37.8, 37.9], "lon": [-4.9, -4.8, -4.7],
+//	 "u (m/s)": [[1.2, 1.5, 2.0], [0.8, 1.1, 1.6]],
+//	 "v (m/s)": [[-3.0, -2.8, -2.5], [-3.4, -3.1, -2.6]]}
+//
+// with a row of u and v for each latitude, and other files as CSV with
+// a header line and a line for each grid point
+//
+//	lat,lon,u,v
+//
+// The CSV grid points may be in any order, but the grid must be full.
+func ReadWindField(file string) (*WindField, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errf("%v", err)
+	}
+	w := &WindField{}
+	if strings.HasSuffix(strings.ToLower(file), ".json") {
+		err = w.parseJSON(data)
+	} else {
+		err = w.parseCSV(data)
+	}
+	if err == nil {
+		err = w.check()
+	}
+	if err != nil {
+		return nil, errf("%s: %v", file, err)
+	}
+	return w, nil
+}
+
+func (w *WindField) parseJSON(data []byte) error {
+	var f jsonWindField
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	w.lat, w.lon, w.u, w.v = f.Lat, f.Lon, f.U, f.V
+	return nil
+}
+
+func (w *WindField) parseCSV(data []byte) error {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = csvSeparator(data)
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(rows) < 2 {
+		return errf("header line and grid point lines needed")
+	}
+	col := map[string]int{"lat": -1, "lon": -1, "u": -1, "v": -1}
+	for i, name := range rows[0] {
+		if _, ok := col[columnName(name)]; ok {
+			col[columnName(name)] = i
+		}
+	}
+	for name, i := range col {
+		if i < 0 {
+			return errf("header must have columns lat, lon, u and v, %s missing", name)
+		}
+	}
+	points := make([][4]float64, 0, len(rows)-1)
+	for i, row := range rows[1:] {
+		var x [4]float64
+		for k, name := range [4]string{"lat", "lon", "u", "v"} {
+			if col[name] >= len(row) {
+				return errf("line %d: missing column", i+2)
+			}
+			if x[k], err = strconv.ParseFloat(strings.TrimSpace(row[col[name]]), 64); err != nil {
+				return errf("line %d: %v", i+2, err)
+			}
+		}
+		points = append(points, x)
+	}
+	w.lat = uniqueSorted(points, 0)
+	w.lon = uniqueSorted(points, 1)
+	if len(w.lat)*len(w.lon) != len(points) {
+		return errf("%d grid points, %d latitudes x %d longitudes",
+			len(points), len(w.lat), len(w.lon))
+	}
+	w.u = newGrid(len(w.lat), len(w.lon))
+	w.v = newGrid(len(w.lat), len(w.lon))
+	for _, x := range points {
+		i := sort.SearchFloat64s(w.lat, x[0])
+		j := sort.SearchFloat64s(w.lon, x[1])
+		w.u[i][j], w.v[i][j] = x[2], x[3]
+	}
+	return nil
+}
+
+func uniqueSorted(points [][4]float64, k int) []float64 {
+	s := make([]float64, 0, len(points))
+	for _, x := range points {
+		s = append(s, x[k])
+	}
+	sort.Float64s(s)
+	n := 0
+	for i := range s {
+		if i == 0 || s[i] != s[n-1] {
+			s[n] = s[i]
+			n++
+		}
+	}
+	return s[:n]
+}
+
+func newGrid(rows, cols int) [][]float64 {
+	g := make([][]float64, rows)
+	for i := range g {
+		g[i] = make([]float64, cols)
+	}
+	return g
+}
+
+func (w *WindField) check() error {
+	if len(w.lat) == 0 || len(w.lon) == 0 {
+		return errf("no grid points")
+	}
+	if !grid.Increasing(w.lat) || !grid.Increasing(w.lon) {
+		return errf("latitudes and longitudes must be in increasing order")
+	}
+	if len(w.u) != len(w.lat) || len(w.v) != len(w.lat) {
+		return errf("u and v must have a row for each latitude")
+	}
+	for i := range w.lat {
+		if len(w.u[i]) != len(w.lon) || len(w.v[i]) != len(w.lon) {
+			return errf("u and v rows must have a value for each longitude")
+		}
+	}
+	return nil
+}
+
+// UV returns the bilinearly interpolated wind components u (east) and
+// v (north) at latitude lat and longitude lon.
+func (w *WindField) UV(lat, lon float64) (u, v float64) {
+	i, ti := grid.Cell(w.lat, lat)
+	j, tj := grid.Cell(w.lon, lon)
+	return grid.Bilinear(w.u, i, j, ti, tj), grid.Bilinear(w.v, i, j, ti, tj)
+}
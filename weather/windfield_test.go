@@ -0,0 +1,21 @@
+package weather
+
+import (
+	"math"
+	"testing"
+)
+
+func TestReadWindFieldCSV(t *testing.T) {
+	file := writeFile(t, "wf.csv", "lon,lat,u,v\n"+
+		"25,61,4,0\n25,60,0,0\n24,61,2,2\n24,60,0,-2\n")
+	w, err := ReadWindField(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, v := w.UV(60.5, 24.5); math.Abs(u-1.5) > 1e-9 || math.Abs(v) > 1e-9 {
+		t.Errorf("center u %.3f v %.3f, want 1.5 0", u, v)
+	}
+	if u, v := w.UV(62, 23); u != 2 || v != 2 {
+		t.Errorf("outside u %.3f v %.3f, want edge 2 2", u, v)
+	}
+}